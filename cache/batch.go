@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+)
+
+var (
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ BatchCacher = (*MemoryCache)(nil)
+	_ BatchCacher = (*redis.Client)(nil)
+)
+
+// BatchCacher is satisfied by Cachers able to read and write many keys at once. GetMany reports
+// each key that couldn't be read in its map of errors, with a not found error for missing keys.
+type BatchCacher interface {
+	GetMany(metrics.Recorder, []string) (map[string]interface{}, map[string]error)
+	SetMany(metrics.Recorder, map[string]interface{}, time.Duration) error
+	DeleteMany(metrics.Recorder, []string) error
+}
+
+// GetMany retrieves the values at keys from cache, decoding each into a new T. Keys that couldn't
+// be retrieved are reported per key in the map of errors, with ErrNotFound for keys not in cache.
+func GetMany[T any](m metrics.Recorder, keys ...string) (map[string]T, map[string]error) {
+	vals := make(map[string]T, len(keys))
+
+	raws, errs := getMany(m, keys)
+	for key, raw := range raws {
+		b, ok := raw.(string)
+		if !ok {
+			errs[key] = ErrDeserialize
+			continue
+		}
+
+		var v T
+		if err := decode(b, &v); err != nil {
+			errs[key] = err
+			continue
+		}
+
+		vals[key] = v
+	}
+
+	return vals, errs
+}
+
+// getMany retrieves the raw values at keys, in a single round trip if the Cacher supports it.
+func getMany(m metrics.Recorder, keys []string) (map[string]interface{}, map[string]error) {
+	switch {
+	case !Enabled:
+		return nil, keyErrors(keys, ErrCacheDisabled)
+	case c == nil:
+		return nil, keyErrors(keys, ErrCacheNil)
+	}
+
+	if b, ok := c.(BatchCacher); ok {
+		raws, errs := b.GetMany(m, keys)
+		for key, err := range errs {
+			if err == redis.ErrNotFound {
+				errs[key] = ErrNotFound
+			}
+		}
+
+		return raws, errs
+	}
+
+	raws := map[string]interface{}{}
+	errs := map[string]error{}
+	for _, key := range keys {
+		raw, err := c.Get(m, key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+
+		raws[key] = raw
+	}
+
+	return raws, errs
+}
+
+// SetMany sets each of values in cache at its key. Values MUST be serializeable by the configured Codec.
+func SetMany(m metrics.Recorder, values map[string]interface{}) error {
+	return SetManyWithDuration(m, values, dur)
+}
+
+// SetManyWithDuration sets each of values in cache at its key, for d. See SetMany.
+func SetManyWithDuration(m metrics.Recorder, values map[string]interface{}, d time.Duration) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if c == nil {
+		return ErrCacheNil
+	}
+
+	if d < 0 {
+		d = time.Duration(c.ForeverTTL())
+	}
+
+	raws := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		raw, err := encode(defaultCodec, value)
+		if err != nil {
+			return err
+		}
+
+		raws[key] = raw
+	}
+
+	if b, ok := c.(BatchCacher); ok {
+		return b.SetMany(m, raws, d)
+	}
+
+	for key, raw := range raws {
+		if err := c.SetWithDuration(m, key, raw, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMany deletes the values at keys from cache.
+func DeleteMany(m metrics.Recorder, keys ...string) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if c == nil {
+		return ErrCacheNil
+	}
+
+	if b, ok := c.(BatchCacher); ok {
+		return b.DeleteMany(m, keys)
+	}
+
+	for _, key := range keys {
+		if err := c.Delete(m, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyErrors reports err for every key.
+func keyErrors(keys []string, err error) map[string]error {
+	errs := make(map[string]error, len(keys))
+	for _, key := range keys {
+		errs[key] = err
+	}
+
+	return errs
+}
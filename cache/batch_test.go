@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	m := &metrics.NoOp{}
+	defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+	type item struct {
+		Name string
+	}
+
+	cachers := map[string]func() Cacher{
+		"Memory": func() Cacher { return NewMemoryCache(time.Minute) },
+		"Redis": func() Cacher {
+			return redis.New(miniredis.RunT(t).Addr(), time.Second, "batch_test")
+		},
+		"Fallback": func() Cacher { return NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute}) },
+	}
+
+	for name, cacher := range cachers {
+		t.Run(name, func(t *testing.T) {
+			Initialize(cacher(), time.Minute)
+
+			require.Nil(t, SetMany(m, map[string]interface{}{
+				"a": item{Name: "first"},
+				"b": item{Name: "second"},
+			}))
+
+			vals, errs := GetMany[item](m, "a", "b", "missing")
+			require.Equal(t, map[string]item{"a": {Name: "first"}, "b": {Name: "second"}}, vals)
+			require.Equal(t, map[string]error{"missing": ErrNotFound}, errs)
+
+			require.Nil(t, DeleteMany(m, "a", "missing"))
+
+			vals, errs = GetMany[item](m, "a", "b")
+			require.Equal(t, map[string]item{"b": {Name: "second"}}, vals)
+			require.Equal(t, map[string]error{"a": ErrNotFound}, errs)
+		})
+	}
+
+	t.Run("Undecodable", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		Initialize(mc, time.Minute)
+
+		require.Nil(t, Set(m, "encoded", "value"))
+		require.Nil(t, mc.Set(m, "raw", 10))
+
+		vals, errs := GetMany[string](m, "encoded", "raw")
+		require.Equal(t, map[string]string{"encoded": "value"}, vals)
+		require.Equal(t, map[string]error{"raw": ErrDeserialize}, errs)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		Enabled = false
+		defer func() { Enabled = true }()
+
+		vals, errs := GetMany[item](m, "a", "b")
+		require.Empty(t, vals)
+		require.Equal(t, map[string]error{"a": ErrCacheDisabled, "b": ErrCacheDisabled}, errs)
+		require.Equal(t, ErrCacheDisabled, SetMany(m, map[string]interface{}{"a": item{}}))
+		require.Equal(t, ErrCacheDisabled, DeleteMany(m, "a"))
+	})
+}
@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+// EvictionPolicy determines which entry a BoundedCache removes when it is full.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU EvictionPolicy = iota
+
+	// LFU evicts the least frequently used entry, falling back to least recently used among equals.
+	LFU
+)
+
+var (
+	// ErrTooLarge is returned when a value is larger than the cache may hold.
+	ErrTooLarge = errors.New("value exceeds cache size")
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Cacher = (*BoundedCache)(nil)
+)
+
+// BoundedOptions configures a BoundedCache. A zero MaxEntries or MaxBytes leaves that dimension unbounded.
+type BoundedOptions struct {
+	// DefaultTTL is the lifetime of values stored with Set.
+	DefaultTTL time.Duration
+
+	// MaxEntries is the most values held at once.
+	MaxEntries int
+
+	// MaxBytes is the most bytes held at once, counting keys and values. Values other than strings
+	// and []byte are sized by their printed representation.
+	MaxBytes int64
+
+	// Policy selects which entry is evicted when the cache is full.
+	Policy EvictionPolicy
+}
+
+// CacheStats are counters describing the use of a BoundedCache.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int64 `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// BoundedCache is an in-memory cache storage that satisfies the Cacher interface, and holds no more than
+// a configured number of entries and bytes.
+type BoundedCache struct {
+	opts BoundedOptions
+
+	mu      sync.Mutex
+	entries map[string]*boundedEntry
+	order   evictionQueue
+	tick    uint64
+	stats   CacheStats
+}
+
+type boundedEntry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time
+
+	// uses and lastUse order entries for eviction. index is the entry's position in the queue.
+	uses    uint64
+	lastUse uint64
+	index   int
+}
+
+// NewBoundedCache returns an in-memory Cacher limited in size by opts.
+func NewBoundedCache(opts BoundedOptions) *BoundedCache {
+	return &BoundedCache{
+		opts:    opts,
+		entries: map[string]*boundedEntry{},
+		order:   evictionQueue{lfu: opts.Policy == LFU},
+	}
+}
+
+// ForeverTTL returns the value that represents the no-expire TTL value.
+func (c *BoundedCache) ForeverTTL() int {
+	return -1
+}
+
+// Get a value from cache.
+func (c *BoundedCache) Get(m metrics.Recorder, key string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(e)
+		ok = false
+	}
+
+	if !ok {
+		c.stats.Misses++
+		metrics.RecordMetric(m, "Cache/Memory/Misses", 1)
+		return nil, ErrNotFound
+	}
+
+	c.touch(e)
+	c.stats.Hits++
+	metrics.RecordMetric(m, "Cache/Memory/Hits", 1)
+	return e.value, nil
+}
+
+// Set a value in cache.
+func (c *BoundedCache) Set(m metrics.Recorder, key string, value interface{}) error {
+	return c.SetWithDuration(m, key, value, c.opts.DefaultTTL)
+}
+
+// SetWithDuration sets a value in cache. A duration of zero or less never expires. Entries are evicted
+// until the value fits.
+func (c *BoundedCache) SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	size := int64(len(key)) + sizeOf(value)
+	if c.opts.MaxBytes > 0 && size > c.opts.MaxBytes {
+		return ErrTooLarge
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	e := &boundedEntry{key: key, value: value, size: size}
+	if d > 0 {
+		e.expires = time.Now().Add(d)
+	}
+
+	evicted := 0
+	for c.full(size) {
+		c.remove(c.order.entries[0])
+		evicted++
+	}
+
+	c.entries[key] = e
+	heap.Push(&c.order, e)
+	c.touch(e)
+	c.stats.Entries++
+	c.stats.Bytes += size
+
+	if evicted > 0 {
+		c.stats.Evictions += int64(evicted)
+		metrics.RecordMetric(m, "Cache/Memory/Evictions", float64(evicted))
+	}
+	metrics.RecordMetric(m, "Cache/Memory/Bytes", float64(c.stats.Bytes))
+
+	return nil
+}
+
+// Delete removes a key from cache.
+func (c *BoundedCache) Delete(m metrics.Recorder, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	return nil
+}
+
+// Stats returns the current counters for the cache.
+func (c *BoundedCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// full reports whether another entry of size would exceed the bounds of the cache.
+func (c *BoundedCache) full(size int64) bool {
+	if len(c.order.entries) == 0 {
+		return false
+	}
+
+	if c.opts.MaxEntries > 0 && len(c.entries) >= c.opts.MaxEntries {
+		return true
+	}
+
+	return c.opts.MaxBytes > 0 && c.stats.Bytes+size > c.opts.MaxBytes
+}
+
+// touch records a use of e.
+func (c *BoundedCache) touch(e *boundedEntry) {
+	c.tick++
+	e.uses++
+	e.lastUse = c.tick
+	heap.Fix(&c.order, e.index)
+}
+
+func (c *BoundedCache) remove(e *boundedEntry) {
+	heap.Remove(&c.order, e.index)
+	delete(c.entries, e.key)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size
+}
+
+// sizeOf estimates the number of bytes held by value.
+func sizeOf(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	default:
+		return int64(len(fmt.Sprint(v)))
+	}
+}
+
+// evictionQueue is a min-heap of entries, ordered such that the next entry to evict is first.
+type evictionQueue struct {
+	entries []*boundedEntry
+	lfu     bool
+}
+
+func (q evictionQueue) Len() int { return len(q.entries) }
+
+func (q evictionQueue) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if q.lfu && a.uses != b.uses {
+		return a.uses < b.uses
+	}
+
+	return a.lastUse < b.lastUse
+}
+
+func (q evictionQueue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.entries[i].index = i
+	q.entries[j].index = j
+}
+
+func (q *evictionQueue) Push(x interface{}) {
+	e := x.(*boundedEntry)
+	e.index = len(q.entries)
+	q.entries = append(q.entries, e)
+}
+
+func (q *evictionQueue) Pop() interface{} {
+	n := len(q.entries) - 1
+	e := q.entries[n]
+	q.entries[n] = nil
+	q.entries = q.entries[:n]
+	return e
+}
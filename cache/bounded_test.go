@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btm6084/utilities/health"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// metricRecorder records custom metrics for inspection.
+type metricRecorder struct {
+	metrics.NoOp
+	recorded map[string]float64
+}
+
+func (r *metricRecorder) RecordMetric(name string, value float64) {
+	r.recorded[name] += value
+}
+
+func TestBoundedCache(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("LRU", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxEntries: 3, Policy: LRU})
+
+		for i := 1; i <= 3; i++ {
+			require.Nil(t, c.Set(m, fmt.Sprint(i), "value"))
+		}
+
+		// Using 1 leaves 2 as the least recently used.
+		_, err := c.Get(m, "1")
+		require.Nil(t, err)
+
+		require.Nil(t, c.Set(m, "4", "value"))
+
+		_, err = c.Get(m, "2")
+		require.Equal(t, ErrNotFound, err)
+		for _, key := range []string{"1", "3", "4"} {
+			_, err := c.Get(m, key)
+			require.Nil(t, err, key)
+		}
+
+		require.Equal(t, CacheStats{Hits: 4, Misses: 1, Evictions: 1, Entries: 3, Bytes: 18}, c.Stats())
+	})
+
+	t.Run("LFU", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxEntries: 3, Policy: LFU})
+
+		for i := 1; i <= 3; i++ {
+			require.Nil(t, c.Set(m, fmt.Sprint(i), "value"))
+		}
+
+		// 2 is used least often, though 1 was used longest ago.
+		for _, key := range []string{"1", "1", "3", "3"} {
+			_, err := c.Get(m, key)
+			require.Nil(t, err)
+		}
+
+		require.Nil(t, c.Set(m, "4", "value"))
+
+		_, err := c.Get(m, "2")
+		require.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Max Bytes", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxBytes: 20})
+
+		require.Nil(t, c.Set(m, "a", "123456789"))
+		require.Nil(t, c.Set(m, "b", "123456789"))
+		require.Nil(t, c.Set(m, "c", "123456789"))
+
+		stats := c.Stats()
+		require.Equal(t, int64(2), stats.Entries)
+		require.Equal(t, int64(20), stats.Bytes)
+		require.Equal(t, int64(1), stats.Evictions)
+
+		_, err := c.Get(m, "a")
+		require.Equal(t, ErrNotFound, err)
+
+		require.Equal(t, ErrTooLarge, c.Set(m, "d", "this value is too large to fit"))
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxEntries: 1})
+
+		require.Nil(t, c.Set(m, "a", "one"))
+		require.Nil(t, c.Set(m, "a", "three"))
+
+		val, err := c.Get(m, "a")
+		require.Nil(t, err)
+		require.Equal(t, "three", val)
+		require.Equal(t, int64(0), c.Stats().Evictions)
+		require.Equal(t, int64(6), c.Stats().Bytes)
+
+		require.Nil(t, c.Delete(m, "a"))
+		require.Equal(t, CacheStats{Hits: 1}, c.Stats())
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute})
+
+		require.Nil(t, c.SetWithDuration(m, "a", "value", 10*time.Millisecond))
+		require.Nil(t, c.SetWithDuration(m, "b", "value", time.Duration(c.ForeverTTL())))
+		time.Sleep(20 * time.Millisecond)
+
+		_, err := c.Get(m, "a")
+		require.Equal(t, ErrNotFound, err)
+
+		_, err = c.Get(m, "b")
+		require.Nil(t, err)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxEntries: 1})
+		r := &metricRecorder{recorded: map[string]float64{}}
+
+		c.Set(r, "a", "value")
+		c.Set(r, "b", "value")
+		c.Get(r, "a")
+		c.Get(r, "b")
+
+		require.Equal(t, float64(1), r.recorded["Cache/Memory/Hits"])
+		require.Equal(t, float64(1), r.recorded["Cache/Memory/Misses"])
+		require.Equal(t, float64(1), r.recorded["Cache/Memory/Evictions"])
+	})
+
+	t.Run("Health Check", func(t *testing.T) {
+		c := NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute, MaxEntries: 1})
+		require.Nil(t, c.Set(m, "a", "value"))
+		_, err := c.Get(m, "a")
+		require.Nil(t, err)
+
+		stats := c.Stats()
+		require.Equal(t, CacheStats{Hits: 1, Entries: 1, Bytes: 6}, stats)
+
+		hc := HealthCheck(c)
+		require.Equal(t, health.OK, hc.Status)
+		require.Equal(t, "bounded_memory_cache", hc.Data["cacheType"])
+		require.Equal(t, stats, hc.Data["stats"])
+
+		// The check leaves the cache as it was, without evicting the only entry it has room for.
+		require.Equal(t, stats, c.Stats())
+		_, err = c.Get(m, "a")
+		require.Nil(t, err)
+	})
+}
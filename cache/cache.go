@@ -1,12 +1,14 @@
 // Package cache provides a generalized cache package that allows anything to be cached
 // without having to know underlying details of where that cache is stored.
-// All items are serialized into JSON and stored as strings. When retrieved, it's
-// unmarshaled into the provided container.
+// All items are serialized by a Codec (JSON unless otherwise configured) and stored as strings
+// prefixed with a small header naming the codec. When retrieved, it's unmarshaled into the
+// provided container using the codec recorded in the header.
 // A single cache is maintained at the package level. The provided cacher should be thread-safe,
 // as no locking occurs in this package.
 package cache
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -24,9 +26,10 @@ import (
 )
 
 var (
-	c         Cacher
-	dur       time.Duration
-	deB64Hint = ":::deB64"
+	c            Cacher
+	dur          time.Duration
+	defaultCodec Codec = JSONCodec{}
+	deB64Hint          = ":::deB64"
 
 	// ErrCacheNil is returned when caching falied due to the provided Cacher being nil
 	ErrCacheNil = errors.New("cache is nil")
@@ -40,6 +43,9 @@ var (
 	// ErrNotFound is returned when no data was found
 	ErrNotFound = errors.New("not found")
 
+	// ErrCachedNotFound is returned when the cache holds a record that the value doesn't exist. See SetNotFound.
+	ErrCachedNotFound = errors.New("cached as not found")
+
 	// Enabled allows caching to be turned on and off. This is useful for turning cache off
 	// via environment variables.
 	Enabled = true
@@ -69,16 +75,34 @@ func init() {
 
 // Initialize must be called prior to use. Do this in main.
 func Initialize(cache Cacher, defaultDuration time.Duration) {
+	InitializeWithCodec(cache, defaultDuration, JSONCodec{})
+}
+
+// InitializeWithCodec initializes the cache, serializing new values with the provided codec.
+// Values written under a previous codec remain readable, as each value records the codec that wrote it.
+func InitializeWithCodec(cache Cacher, defaultDuration time.Duration, codec Codec) {
 	if !Enabled {
 		return
 	}
 
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	RegisterCodec(codec)
+
 	c = cache
 	dur = defaultDuration
+	defaultCodec = codec
 }
 
 // Get a value from cache.
 func Get(r metrics.Recorder, key string, container interface{}) error {
+	return GetContext(withRecorder(r), key, container)
+}
+
+// GetContext gets a value from cache. The lookup is abandoned if ctx is canceled.
+func GetContext(ctx context.Context, key string, container interface{}) error {
 	if !Enabled {
 		return ErrCacheDisabled
 	}
@@ -87,7 +111,7 @@ func Get(r metrics.Recorder, key string, container interface{}) error {
 		return ErrCacheNil
 	}
 
-	raw, err := c.Get(r, key)
+	raw, err := WithContext(c).Get(ctx, key)
 	if err != nil {
 		return err
 	}
@@ -97,6 +121,32 @@ func Get(r metrics.Recorder, key string, container interface{}) error {
 		return ErrDeserialize
 	}
 
+	return decode(b, container)
+}
+
+// decode extracts a stored value into container using the codec named in its header.
+func decode(raw string, container interface{}) error {
+	name, payload, framed, err := unframe(raw)
+	if err != nil {
+		return err
+	}
+
+	if framed && name != (JSONCodec{}).Name() {
+		codec, err := lookupCodec(name)
+		if err != nil {
+			return err
+		}
+
+		return codec.Unmarshal([]byte(payload), container)
+	}
+
+	return decodeJSON(payload, container)
+}
+
+// decodeJSON extracts a value written by the JSON serializer, which base64 encodes byte slices.
+func decodeJSON(b string, container interface{}) error {
+	var err error
+
 	switch container.(type) {
 	case []byte, *[]byte:
 		if !strings.HasSuffix(b, deB64Hint) {
@@ -148,26 +198,43 @@ func Get(r metrics.Recorder, key string, container interface{}) error {
 	}
 }
 
-// Set a value in cache. Value MUST be serializeable by JSON. UnExported fields will be ignored!
+// Set a value in cache. Value MUST be serializeable by the configured Codec. With the default
+// JSON codec, UnExported fields will be ignored!
 func Set(m metrics.Recorder, key string, value interface{}) error {
+	return SetContext(withRecorder(m), key, value)
+}
+
+// SetContext sets a value in cache. See Set. The write is abandoned if ctx is canceled.
+func SetContext(ctx context.Context, key string, value interface{}) error {
 	if !Enabled {
 		return ErrCacheDisabled
 	}
 
-	return SetWithDuration(m, key, value, dur)
+	return SetWithDurationContext(ctx, key, value, dur)
 }
 
 // Delete a value from cache.
 func Delete(m metrics.Recorder, key string) error {
+	return DeleteContext(withRecorder(m), key)
+}
+
+// DeleteContext deletes a value from cache. The delete is abandoned if ctx is canceled.
+func DeleteContext(ctx context.Context, key string) error {
 	if !Enabled {
 		return ErrCacheDisabled
 	}
 
-	return c.Delete(m, key)
+	return WithContext(c).Delete(ctx, key)
 }
 
-// SetWithDuration sets a value in cache. Value MUST be serializeable by JSON. UnExported fields will be ignored!
+// SetWithDuration sets a value in cache. Value MUST be serializeable by the configured Codec. With the
+// default JSON codec, UnExported fields will be ignored!
 func SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	return SetWithDurationContext(withRecorder(m), key, value, d)
+}
+
+// SetWithDurationContext sets a value in cache. See SetWithDuration. The write is abandoned if ctx is canceled.
+func SetWithDurationContext(ctx context.Context, key string, value interface{}, d time.Duration) error {
 	if d < 0 {
 		d = time.Duration(c.ForeverTTL())
 	}
@@ -180,19 +247,47 @@ func SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.D
 		return ErrCacheNil
 	}
 
-	raw, err := json.Marshal(value)
+	raw, err := encode(defaultCodec, value)
 	if err != nil {
 		return err
 	}
 
+	return WithContext(c).SetWithDuration(ctx, key, raw, d)
+}
+
+// codecFor returns the codec value is stored with: its own choice if it has one, and otherwise the
+// configured Codec.
+func codecFor(value interface{}) Codec {
+	if e, ok := value.(encodedWith); ok {
+		return e.cacheCodec()
+	}
+
+	return defaultCodec
+}
+
+// encode serializes value with the given codec and prepends the codec header.
+func encode(codec Codec, value interface{}) (string, error) {
+	if codec.Name() != (JSONCodec{}).Name() {
+		b, err := codec.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+
+		return frame(codec.Name(), b), nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
 	hint := ""
 	switch value.(type) {
 	case []byte, *[]byte:
 		hint = deB64Hint
 	}
 
-	c.SetWithDuration(m, key, string(raw)+hint, d)
-	return nil
+	return frame(codec.Name(), append(raw, hint...)), nil
 }
 
 func stripQuotes(in string) []byte {
@@ -272,8 +367,14 @@ func HealthCheck(c Cacher) *health.Check {
 	case *redis.Client:
 		return checkRedis(c)
 
-	case *MemoryCache:
+	case *MemoryCache, *BoundedCache:
 		return checkMemoryCache(c)
+
+	case *TieredCache:
+		return checkTieredCache(c)
+
+	case *EncryptedCache:
+		return HealthCheck(c.(*EncryptedCache).Cacher)
 	}
 
 	return &health.Check{
@@ -284,19 +385,7 @@ func HealthCheck(c Cacher) *health.Check {
 }
 
 func DefaultHealthCheck() *health.Check {
-	switch c.(type) {
-	case *redis.Client:
-		return checkRedis(c)
-
-	case *MemoryCache:
-		return checkMemoryCache(c)
-	}
-
-	return &health.Check{
-		Name:   "no_cache",
-		Status: health.CRITICAL,
-		Data:   map[string]interface{}{},
-	}
+	return HealthCheck(c)
 }
 
 func checkRedis(c Cacher) *health.Check {
@@ -335,6 +424,17 @@ func checkRedis(c Cacher) *health.Check {
 		hc.Description = fmt.Sprintf("redis cache storage error: %s", err)
 	}
 
+	// While the circuit breaker is open, the cache is bypassed rather than failing requests.
+	if b := rdb.Breaker(); b != nil {
+		state := b.State()
+		hc.Data["circuitBreaker"] = state.String()
+
+		if state != redis.BreakerClosed {
+			hc.Status = health.WARNING
+			hc.Description = fmt.Sprintf("redis circuit breaker is %s", state)
+		}
+	}
+
 	hc.Data["pingTime"] = time.Since(start).String()
 	return &hc
 }
@@ -350,6 +450,15 @@ func checkMemoryCache(c Cacher) *health.Check {
 		},
 	}
 
+	// A probe written to a BoundedCache could evict an entry, and would skew its stats, so it's
+	// reported by its stats instead.
+	if b, ok := c.(*BoundedCache); ok {
+		hc.Data["cacheType"] = "bounded_memory_cache"
+		hc.Data["stats"] = b.Stats()
+		hc.Data["pingTime"] = time.Since(start).String()
+		return &hc
+	}
+
 	setVal := time.Now().String()
 	err := c.Set(&metrics.NoOp{}, "healthcheck_test_key", setVal)
 	if err != nil {
@@ -381,6 +490,33 @@ func checkMemoryCache(c Cacher) *health.Check {
 	return &hc
 }
 
+func checkTieredCache(c Cacher) *health.Check {
+	t, ok := c.(*TieredCache)
+	if !ok {
+		return &health.Check{
+			Name:        "cache",
+			Status:      health.CRITICAL,
+			Description: "expected tiered type cacher",
+		}
+	}
+
+	hc := checkMemoryCache(t.l1)
+	hc.Data["cacheType"] = "tiered"
+
+	if _, ok := t.l2.(*redis.Client); !ok {
+		return hc
+	}
+
+	l2 := checkRedis(t.l2.(*redis.Client))
+	hc.Data["l2PingTime"] = l2.Data["pingTime"]
+	if l2.Status != health.OK {
+		hc.Status = l2.Status
+		hc.Description = l2.Description
+	}
+
+	return hc
+}
+
 // Add a random amount of time to a time.Duration. Percent will be between min and max, inclusive.
 func FuzzDuration(d time.Duration, min, max int) time.Duration {
 	max = conv.MaxInt(min, max)
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// headerPrefix marks a stored value as carrying a codec header. A JSON document can never
+	// begin with a NUL byte, so values written before headers existed are never mistaken for one.
+	headerPrefix = "\x00cache:"
+
+	// headerVersion is the version of the header layout written by this package.
+	headerVersion = 1
+)
+
+var (
+	// ErrUnknownCodec is returned when a stored value names a codec that has not been registered.
+	ErrUnknownCodec = errors.New("cached value was stored with an unknown codec")
+
+	// ErrUnsupportedType is returned when a codec cannot serialize the provided type.
+	ErrUnsupportedType = errors.New("codec does not support the provided type")
+
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(GobCodec{})
+	RegisterCodec(MsgpackCodec{})
+	RegisterCodec(RawCodec{})
+}
+
+// Codec serializes values to and from the raw form kept in a Cacher.
+type Codec interface {
+	// Name uniquely identifies the codec. It is written into the header of every stored value
+	// so that the value can be decoded after the configured codec changes.
+	Name() string
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte, interface{}) error
+}
+
+// RegisterCodec makes a codec available for decoding stored values. The built in codecs are
+// registered automatically; custom codecs must be registered before values they wrote are read.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+func lookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+
+	return codec, nil
+}
+
+// frame prepends the versioned codec header to a serialized value.
+func frame(codec string, payload []byte) string {
+	return headerPrefix + strconv.Itoa(headerVersion) + ":" + codec + ":" + string(payload)
+}
+
+// unframe splits a stored value into the name of the codec that wrote it and its payload.
+// Values without a header were written by the legacy JSON serializer, and are reported as unframed.
+func unframe(raw string) (string, string, bool, error) {
+	if !strings.HasPrefix(raw, headerPrefix) {
+		return "", raw, false, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(raw, headerPrefix), ":", 3)
+	if len(parts) != 3 {
+		return "", "", true, ErrDeserialize
+	}
+
+	if v, err := strconv.Atoi(parts[0]); err != nil || v > headerVersion {
+		return "", "", true, ErrDeserialize
+	}
+
+	if parts[1] == notFoundCodec {
+		return "", "", true, ErrCachedNotFound
+	}
+
+	return parts[1], parts[2], true, nil
+}
+
+// JSONCodec serializes values using encoding/json. UnExported fields will be ignored!
+type JSONCodec struct{}
+
+// Name returns the codec identifier.
+func (JSONCodec) Name() string { return "json" }
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v, which must be a pointer.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec serializes values using encoding/gob. Gob cannot encode nil pointers, and interface
+// values must have their concrete types registered via gob.Register.
+type GobCodec struct{}
+
+// Name returns the codec identifier.
+func (GobCodec) Name() string { return "gob" }
+
+// Marshal encodes v as gob.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into v, which must be a pointer.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec serializes values using the MessagePack binary format. Struct fields are named
+// by their json tags so that types shared with JSONCodec round-trip identically.
+type MsgpackCodec struct{}
+
+// Name returns the codec identifier.
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+// Marshal encodes v as MessagePack.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes MessagePack data into v, which must be a pointer.
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	return dec.Decode(v)
+}
+
+// RawCodec stores strings and byte slices as-is, with no serialization overhead.
+// Any other type results in ErrUnsupportedType.
+type RawCodec struct{}
+
+// Name returns the codec identifier.
+func (RawCodec) Name() string { return "raw" }
+
+// Marshal returns the bytes of a string or byte slice.
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return t, nil
+	case *[]byte:
+		if t == nil {
+			return nil, nil
+		}
+		return *t, nil
+	case string:
+		return []byte(t), nil
+	case *string:
+		if t == nil {
+			return nil, nil
+		}
+		return []byte(*t), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+// Unmarshal copies data into a *[]byte or *string.
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch t := v.(type) {
+	case *[]byte:
+		if len(data) == 0 {
+			*t = nil
+			return nil
+		}
+		*t = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*t = string(data)
+		return nil
+	case *interface{}:
+		*t = string(data)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
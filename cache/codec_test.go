@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	type TestStruct struct {
+		Bool   bool              `json:"bool"`
+		Int    int               `json:"int"`
+		Slice  []byte            `json:"slice"`
+		String string            `json:"string"`
+		Things map[string]string `json:"things"`
+	}
+
+	data := TestStruct{
+		Bool:   true,
+		Int:    12786,
+		Slice:  []byte{'\x00', '\x01', '\xff'},
+		String: "Such a nice string",
+		Things: map[string]string{"Oh": "Didn't See you there"},
+	}
+
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}, MsgpackCodec{}} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			InitializeWithCodec(NewMemoryCache(time.Minute), time.Minute, codec)
+			defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+			require.Nil(t, Set(m, t.Name(), data))
+
+			var actual TestStruct
+			require.Nil(t, Get(m, t.Name(), &actual))
+			require.Equal(t, data, actual)
+
+			tc := NewTyped[TestStruct](c, codec, time.Minute)
+			require.Nil(t, tc.Set(m, t.Name(), data))
+
+			typed, err := tc.Get(m, t.Name())
+			require.Nil(t, err)
+			require.Equal(t, data, typed)
+		})
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		InitializeWithCodec(NewMemoryCache(time.Minute), time.Minute, RawCodec{})
+		defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+		body := []byte{'\x00', '\x01', '"', '\xff'}
+		require.Nil(t, Set(m, t.Name(), body))
+
+		var actual []byte
+		require.Nil(t, Get(m, t.Name(), &actual))
+		require.Equal(t, body, actual)
+
+		var str string
+		require.Nil(t, Get(m, t.Name(), &str))
+		require.Equal(t, string(body), str)
+
+		require.ErrorIs(t, Set(m, t.Name(), 12), ErrUnsupportedType)
+	})
+
+	t.Run("Codec Change Keeps Old Entries", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+		Initialize(mc, time.Minute)
+		require.Nil(t, Set(m, "json", data))
+
+		// Written before codec headers existed.
+		require.Nil(t, mc.Set(m, "legacy", `{"bool":true,"int":5}`))
+
+		InitializeWithCodec(mc, time.Minute, GobCodec{})
+		require.Nil(t, Set(m, "gob", data))
+
+		for _, key := range []string{"json", "gob"} {
+			var actual TestStruct
+			require.Nil(t, Get(m, key, &actual))
+			require.Equal(t, data, actual)
+		}
+
+		var legacy TestStruct
+		require.Nil(t, Get(m, "legacy", &legacy))
+		require.Equal(t, TestStruct{Bool: true, Int: 5}, legacy)
+	})
+
+	t.Run("Unknown Codec", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		require.Nil(t, mc.Set(m, t.Name(), frame("nope", []byte("abc"))))
+
+		var actual string
+		require.ErrorIs(t, decodeFrom(t, mc, t.Name(), &actual), ErrUnknownCodec)
+	})
+}
+
+func decodeFrom(t *testing.T, cacher Cacher, key string, container interface{}) error {
+	raw, err := cacher.Get(&metrics.NoOp{}, key)
+	require.Nil(t, err)
+
+	return decode(raw.(string), container)
+}
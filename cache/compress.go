@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CompressionGzip stores cached response bodies gzip compressed.
+	CompressionGzip = "gzip"
+
+	// CompressionDeflate stores cached response bodies deflate compressed, in the zlib format that
+	// HTTP's deflate content coding calls for.
+	CompressionDeflate = "deflate"
+)
+
+// compress replaces the event's Content with its body compressed by encoding.
+func (ce *CacheEvent) compress(encoding string) error {
+	var buf bytes.Buffer
+
+	var zw io.WriteCloser
+	switch encoding {
+	case CompressionGzip:
+		zw = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return fmt.Errorf("unsupported cache compression %q", encoding)
+	}
+
+	if _, err := zw.Write([]byte(ce.Content)); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	ce.Compressed = buf.Bytes()
+	ce.Encoding = encoding
+	ce.Content = ""
+	return nil
+}
+
+// body returns the response body to send to r, along with the Content-Encoding it's sent with.
+// Compressed bodies are sent as stored to clients that accept their encoding, and decompressed
+// for clients that don't.
+func (ce CacheEvent) body(r *http.Request) ([]byte, string, error) {
+	if ce.Encoding == "" {
+		return []byte(ce.Content), "", nil
+	}
+
+	if acceptsEncoding(r, ce.Encoding) {
+		return ce.Compressed, ce.Encoding, nil
+	}
+
+	var err error
+	var zr io.ReadCloser
+	switch ce.Encoding {
+	case CompressionGzip:
+		zr, err = gzip.NewReader(bytes.NewReader(ce.Compressed))
+	case CompressionDeflate:
+		zr, err = zlib.NewReader(bytes.NewReader(ce.Compressed))
+	default:
+		return nil, "", fmt.Errorf("unsupported cache compression %q", ce.Encoding)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer zr.Close()
+
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, "", nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of r allows a response in encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	accepted := false
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != encoding && name != "*" {
+				continue
+			}
+
+			q := 1.0
+			if p := strings.TrimSpace(params); strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64); err == nil {
+					q = v
+				}
+			}
+
+			// An explicit entry for the encoding takes precedence over the wildcard.
+			if name == encoding {
+				return q > 0
+			}
+			accepted = q > 0
+		}
+	}
+
+	return accepted
+}
+
+// representationETag returns the entity tag of a response body sent with the given encoding.
+// Compressed representations need a tag distinct from the uncompressed body's.
+func representationETag(etag, encoding string) string {
+	if etag == "" || encoding == "" {
+		return etag
+	}
+
+	if strings.HasSuffix(etag, `"`) {
+		return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+
+	return etag + "-" + encoding
+}
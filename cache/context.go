@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+var (
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ ContextCacher = contextAdapter{}
+	_ Cacher        = recorderAdapter{}
+)
+
+// ContextCacher provides an interface for working with a cache store, where each operation is abandoned
+// if its context is canceled. The metrics.Recorder is taken from the context by metrics.GetRecorder.
+type ContextCacher interface {
+	Get(context.Context, string) (interface{}, error)
+	Set(context.Context, string, interface{}) error
+	SetWithDuration(context.Context, string, interface{}, time.Duration) error
+	Delete(context.Context, string) error
+
+	// ForeverTTL returns the specific value that represents the no-expire TTL value.
+	ForeverTTL() int
+}
+
+// nativeContext is satisfied by Cachers that also accept a context for each operation, such as redis.Client.
+type nativeContext interface {
+	GetContext(context.Context, string) (interface{}, error)
+	SetContext(context.Context, string, interface{}) error
+	SetWithDurationContext(context.Context, string, interface{}, time.Duration) error
+	DeleteContext(context.Context, string) error
+}
+
+// WithContext adapts a Cacher to the ContextCacher interface. Cachers that accept a context natively,
+// such as redis.Client, have it passed through. Otherwise, operations fail if the context is already
+// canceled, but can't be abandoned once started.
+func WithContext(c Cacher) ContextCacher {
+	if r, ok := c.(recorderAdapter); ok {
+		return r.c
+	}
+
+	return contextAdapter{c}
+}
+
+// FromContext adapts a ContextCacher to the Cacher interface, for use with Initialize. Operations run
+// with a background context carrying the provided metrics.Recorder.
+func FromContext(c ContextCacher) Cacher {
+	if a, ok := c.(contextAdapter); ok {
+		return a.c
+	}
+
+	return recorderAdapter{c}
+}
+
+type contextAdapter struct {
+	c Cacher
+}
+
+func (a contextAdapter) ForeverTTL() int {
+	return a.c.ForeverTTL()
+}
+
+func (a contextAdapter) Get(ctx context.Context, key string) (interface{}, error) {
+	if n, ok := a.c.(nativeContext); ok {
+		return n.GetContext(ctx, key)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.c.Get(metrics.GetRecorder(ctx), key)
+}
+
+func (a contextAdapter) Set(ctx context.Context, key string, value interface{}) error {
+	if n, ok := a.c.(nativeContext); ok {
+		return n.SetContext(ctx, key, value)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.c.Set(metrics.GetRecorder(ctx), key, value)
+}
+
+func (a contextAdapter) SetWithDuration(ctx context.Context, key string, value interface{}, d time.Duration) error {
+	if n, ok := a.c.(nativeContext); ok {
+		return n.SetWithDurationContext(ctx, key, value, d)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.c.SetWithDuration(metrics.GetRecorder(ctx), key, value, d)
+}
+
+func (a contextAdapter) Delete(ctx context.Context, key string) error {
+	if n, ok := a.c.(nativeContext); ok {
+		return n.DeleteContext(ctx, key)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.c.Delete(metrics.GetRecorder(ctx), key)
+}
+
+// detachedContext carries the values of its parent, but not its deadline or cancellation. This allows
+// work started by a request, or shared by several callers, to outlive it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+type recorderAdapter struct {
+	c ContextCacher
+}
+
+func (a recorderAdapter) ForeverTTL() int {
+	return a.c.ForeverTTL()
+}
+
+func (a recorderAdapter) Get(m metrics.Recorder, key string) (interface{}, error) {
+	return a.c.Get(withRecorder(m), key)
+}
+
+func (a recorderAdapter) Set(m metrics.Recorder, key string, value interface{}) error {
+	return a.c.Set(withRecorder(m), key, value)
+}
+
+func (a recorderAdapter) SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	return a.c.SetWithDuration(withRecorder(m), key, value, d)
+}
+
+func (a recorderAdapter) Delete(m metrics.Recorder, key string) error {
+	return a.c.Delete(withRecorder(m), key)
+}
+
+// withRecorder returns a background context carrying m.
+func withRecorder(m metrics.Recorder) context.Context {
+	return metrics.ContextWithRecorder(context.Background(), m)
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingCacher records the Recorder each operation is called with.
+type recordingCacher struct {
+	*MemoryCache
+	recorders []metrics.Recorder
+}
+
+func (c *recordingCacher) Get(m metrics.Recorder, key string) (interface{}, error) {
+	c.recorders = append(c.recorders, m)
+	return c.MemoryCache.Get(m, key)
+}
+
+func (c *recordingCacher) SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	c.recorders = append(c.recorders, m)
+	return c.MemoryCache.SetWithDuration(m, key, value, d)
+}
+
+// nativeContextCacher is a ContextCacher that isn't built from a Cacher.
+type nativeContextCacher struct {
+	ContextCacher
+}
+
+func TestContextCacher(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("Adapts Cacher", func(t *testing.T) {
+		rc := &recordingCacher{MemoryCache: NewMemoryCache(time.Minute).(*MemoryCache)}
+		cc := WithContext(rc)
+		ctx := metrics.ContextWithRecorder(context.Background(), m)
+
+		require.Nil(t, cc.SetWithDuration(ctx, "adapted", "value", time.Minute))
+		val, err := cc.Get(ctx, "adapted")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		require.Len(t, rc.recorders, 2)
+		require.Same(t, m, rc.recorders[0])
+		require.Same(t, m, rc.recorders[1])
+	})
+
+	t.Run("Adapts ContextCacher", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		require.Same(t, mc, FromContext(WithContext(mc)))
+
+		cc := nativeContextCacher{WithContext(mc)}
+		require.Equal(t, cc, WithContext(FromContext(cc)))
+
+		require.Nil(t, FromContext(cc).Set(m, "round-trip", "value"))
+		val, err := cc.Get(context.Background(), "round-trip")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+	})
+
+	t.Run("Canceled Context", func(t *testing.T) {
+		cc := WithContext(NewMemoryCache(time.Minute))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.Equal(t, context.Canceled, cc.Set(ctx, "canceled", "value"))
+		_, err := cc.Get(ctx, "canceled")
+		require.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("Redis", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		cc := WithContext(redis.New(mr.Addr(), time.Second, "context_test"))
+
+		require.Nil(t, cc.Set(context.Background(), "redis", "value"))
+		val, err := cc.Get(context.Background(), "redis")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = cc.Get(ctx, "redis")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Aborts In-Flight Redis Calls", func(t *testing.T) {
+		// A server that accepts connections but never responds.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(t, err)
+		defer ln.Close()
+
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		// Timeouts far beyond the cancellation, so that only the cancellation can end the call.
+		rdb := redis.NewWithOptions(redis.ClientOptions{
+			Addr:           ln.Addr().String(),
+			ClientName:     "context_test",
+			RequestTimeout: time.Minute,
+			ReadTimeout:    time.Minute,
+		})
+		defer rdb.RDB.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = WithContext(rdb).Get(ctx, "hung")
+		require.NotNil(t, err)
+		require.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
+
+func TestContextFunctions(t *testing.T) {
+	defer Initialize(NewMemoryCache(5*time.Minute), 0)
+	Initialize(NewMemoryCache(time.Minute), time.Minute)
+
+	ctx := context.Background()
+
+	require.Nil(t, SetContext(ctx, t.Name(), "value"))
+
+	var actual string
+	require.Nil(t, GetContext(ctx, t.Name(), &actual))
+	require.Equal(t, "value", actual)
+
+	require.Nil(t, DeleteContext(ctx, t.Name()))
+	require.Equal(t, ErrNotFound, GetContext(ctx, t.Name(), &actual))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	calls := 0
+	err := GetOrLoadContext(canceled, t.Name(), &actual, time.Minute, func() (interface{}, error) {
+		calls++
+		return "loaded", nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 0, calls)
+	require.Equal(t, ErrNotFound, GetContext(ctx, t.Name(), &actual))
+}
+
+func TestMiddlewareRequestContext(t *testing.T) {
+	rc := &recordingCacher{MemoryCache: NewMemoryCache(time.Minute).(*MemoryCache)}
+	defer Initialize(NewMemoryCache(5*time.Minute), 0)
+	Initialize(rc, time.Minute)
+
+	m := &metrics.NoOp{}
+	h := NewMiddleware(MiddlewareOptions{Duration: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/context", nil)
+	r = r.WithContext(metrics.ContextWithRecorder(r.Context(), m))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.NotEmpty(t, rc.recorders)
+	for _, rec := range rc.recorders {
+		require.Same(t, m, rec)
+	}
+}
@@ -0,0 +1,351 @@
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+)
+
+// encryptedPrefix marks a stored value as encrypted. It's followed by the ID of the key that
+// encrypted the value, a colon, and the base64 encoded nonce and ciphertext.
+const encryptedPrefix = "\x00enc:"
+
+var (
+	// ErrDecrypt is returned when a cached value could not be decrypted, including values that were
+	// stored unencrypted.
+	ErrDecrypt = errors.New("cached value could not be decrypted")
+
+	// ErrUnknownKey is returned when a cached value was encrypted with a key the cache wasn't given.
+	ErrUnknownKey = errors.New("cached value was encrypted with an unknown key")
+
+	// errLocksUnsupported is returned by TryLock when the underlying Cacher can't take locks.
+	errLocksUnsupported = errors.New("cache does not support locks")
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ TagCacher     = (*EncryptedCache)(nil)
+	_ BatchCacher   = (*EncryptedCache)(nil)
+	_ nativeContext = (*EncryptedCache)(nil)
+	_ loadLocker    = (*EncryptedCache)(nil)
+)
+
+// EncryptionKey is an AES key of 16, 24 or 32 bytes. Its ID is stored with each value it encrypts,
+// so that the value can be decrypted once a newer key is in use. IDs may not contain a colon.
+type EncryptionKey struct {
+	ID  string
+	Key []byte
+}
+
+// EncryptedCache is a Cacher that encrypts values with AES-GCM before storing them in another
+// Cacher, and decrypts them when retrieved. Each value is bound to its cache key, so that an
+// encrypted value copied to a different key fails to decrypt. Only string and []byte values may
+// be stored, which includes every value stored through the package level functions.
+//
+// Batches, contexts and locks are passed through to the underlying Cacher when it supports them,
+// so that wrapping a redis.Client keeps its round trips, cancellation and DistributedLoad.
+type EncryptedCache struct {
+	Cacher Cacher
+
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewEncryptedCache returns an EncryptedCache storing values in c. New values are encrypted with
+// current, while values encrypted with any of previous remain readable, allowing keys to be rotated.
+func NewEncryptedCache(c Cacher, current EncryptionKey, previous ...EncryptionKey) (*EncryptedCache, error) {
+	e := &EncryptedCache{
+		Cacher:  c,
+		current: current.ID,
+		keys:    map[string]cipher.AEAD{},
+	}
+
+	for _, k := range append([]EncryptionKey{current}, previous...) {
+		if k.ID == "" || strings.Contains(k.ID, ":") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", k.ID)
+		}
+
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", k.ID, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", k.ID, err)
+		}
+
+		e.keys[k.ID] = aead
+	}
+
+	return e, nil
+}
+
+// ForeverTTL returns the no-expire TTL value of the underlying Cacher.
+func (e *EncryptedCache) ForeverTTL() int {
+	return e.Cacher.ForeverTTL()
+}
+
+// Get retrieves and decrypts a value from cache.
+func (e *EncryptedCache) Get(m metrics.Recorder, key string) (interface{}, error) {
+	raw, err := e.Cacher.Get(m, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.open(key, raw)
+}
+
+// Set encrypts and stores a value in cache with the underlying Cacher's default TTL.
+func (e *EncryptedCache) Set(m metrics.Recorder, key string, value interface{}) error {
+	sealed, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return e.Cacher.Set(m, key, sealed)
+}
+
+// SetWithDuration encrypts and stores a value in cache.
+func (e *EncryptedCache) SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	sealed, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return e.Cacher.SetWithDuration(m, key, sealed, d)
+}
+
+// Delete removes a key from cache.
+func (e *EncryptedCache) Delete(m metrics.Recorder, key string) error {
+	return e.Cacher.Delete(m, key)
+}
+
+// SetWithTags encrypts and stores a value in cache with tags, if the underlying Cacher supports them.
+func (e *EncryptedCache) SetWithTags(m metrics.Recorder, key string, value interface{}, d time.Duration, tags ...string) error {
+	tc, ok := e.Cacher.(TagCacher)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	sealed, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return tc.SetWithTags(m, key, sealed, d, tags...)
+}
+
+// InvalidateTag removes every key associated with tag, if the underlying Cacher supports tags.
+func (e *EncryptedCache) InvalidateTag(m metrics.Recorder, tag string) error {
+	tc, ok := e.Cacher.(TagCacher)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	return tc.InvalidateTag(m, tag)
+}
+
+// DeletePrefix removes every key beginning with prefix, if the underlying Cacher supports it.
+func (e *EncryptedCache) DeletePrefix(m metrics.Recorder, prefix string) error {
+	tc, ok := e.Cacher.(TagCacher)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	return tc.DeletePrefix(m, prefix)
+}
+
+// GetContext retrieves and decrypts a value from cache. The lookup is abandoned if ctx is canceled.
+func (e *EncryptedCache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	raw, err := WithContext(e.Cacher).Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.open(key, raw)
+}
+
+// SetContext encrypts and stores a value in cache with the underlying Cacher's default TTL.
+func (e *EncryptedCache) SetContext(ctx context.Context, key string, value interface{}) error {
+	sealed, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return WithContext(e.Cacher).Set(ctx, key, sealed)
+}
+
+// SetWithDurationContext encrypts and stores a value in cache.
+func (e *EncryptedCache) SetWithDurationContext(ctx context.Context, key string, value interface{}, d time.Duration) error {
+	sealed, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return WithContext(e.Cacher).SetWithDuration(ctx, key, sealed, d)
+}
+
+// DeleteContext removes a key from cache.
+func (e *EncryptedCache) DeleteContext(ctx context.Context, key string) error {
+	return WithContext(e.Cacher).Delete(ctx, key)
+}
+
+// GetMany retrieves and decrypts the values at keys, in a single round trip if the underlying
+// Cacher supports it.
+func (e *EncryptedCache) GetMany(m metrics.Recorder, keys []string) (map[string]interface{}, map[string]error) {
+	raws := map[string]interface{}{}
+	errs := map[string]error{}
+
+	if b, ok := e.Cacher.(BatchCacher); ok {
+		raws, errs = b.GetMany(m, keys)
+		if errs == nil {
+			errs = map[string]error{}
+		}
+	} else {
+		for _, key := range keys {
+			raw, err := e.Cacher.Get(m, key)
+			if err != nil {
+				errs[key] = err
+				continue
+			}
+
+			raws[key] = raw
+		}
+	}
+
+	vals := make(map[string]interface{}, len(raws))
+	for key, raw := range raws {
+		val, err := e.open(key, raw)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+
+		vals[key] = val
+	}
+
+	return vals, errs
+}
+
+// SetMany encrypts each of values and stores it at its key, in a single round trip if the underlying
+// Cacher supports it.
+func (e *EncryptedCache) SetMany(m metrics.Recorder, values map[string]interface{}, d time.Duration) error {
+	sealed := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		s, err := e.encrypt(key, value)
+		if err != nil {
+			return err
+		}
+
+		sealed[key] = s
+	}
+
+	if b, ok := e.Cacher.(BatchCacher); ok {
+		return b.SetMany(m, sealed, d)
+	}
+
+	for key, s := range sealed {
+		if err := e.Cacher.SetWithDuration(m, key, s, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMany removes the values at keys from cache.
+func (e *EncryptedCache) DeleteMany(m metrics.Recorder, keys []string) error {
+	if b, ok := e.Cacher.(BatchCacher); ok {
+		return b.DeleteMany(m, keys)
+	}
+
+	for _, key := range keys {
+		if err := e.Cacher.Delete(m, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TryLock takes a lock through the underlying Cacher, if it supports locking. The name of the lock
+// isn't encrypted.
+func (e *EncryptedCache) TryLock(ctx context.Context, key string, ttl time.Duration) (redis.Lock, error) {
+	l, ok := e.Cacher.(loadLocker)
+	if !ok {
+		return nil, errLocksUnsupported
+	}
+
+	return l.TryLock(ctx, key, ttl)
+}
+
+// open decrypts a raw value stored at key.
+func (e *EncryptedCache) open(key string, raw interface{}) (interface{}, error) {
+	b, ok := rawBytes(raw)
+	if !ok {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := e.decrypt(key, string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(plain), nil
+}
+
+// encrypt seals value with the current key, using key as additional data.
+func (e *EncryptedCache) encrypt(key string, value interface{}) (string, error) {
+	plain, ok := rawBytes(value)
+	if !ok {
+		return "", ErrUnsupportedType
+	}
+
+	aead := e.keys[e.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plain, []byte(key))
+	return encryptedPrefix + e.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a value sealed by encrypt for key.
+func (e *EncryptedCache) decrypt(key, raw string) ([]byte, error) {
+	if !strings.HasPrefix(raw, encryptedPrefix) {
+		return nil, ErrDecrypt
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(raw, encryptedPrefix), ":")
+	if !ok {
+		return nil, ErrDecrypt
+	}
+
+	aead, ok := e.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedCache(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	oldKey := EncryptionKey{ID: "v1", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := EncryptionKey{ID: "v2", Key: bytes.Repeat([]byte{2}, 16)}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		ec, err := NewEncryptedCache(mc, newKey)
+		require.Nil(t, err)
+
+		require.Nil(t, ec.SetWithDuration(m, "pii", "jane@example.com", time.Minute))
+
+		stored, err := mc.Get(m, "pii")
+		require.Nil(t, err)
+		require.NotContains(t, stored, "jane@example.com")
+		require.Contains(t, stored, "v2:")
+
+		val, err := ec.Get(m, "pii")
+		require.Nil(t, err)
+		require.Equal(t, "jane@example.com", val)
+	})
+
+	t.Run("Package Functions", func(t *testing.T) {
+		ec, err := NewEncryptedCache(NewMemoryCache(time.Minute), newKey)
+		require.Nil(t, err)
+
+		Initialize(ec, time.Minute)
+		defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+		type person struct {
+			Email string
+		}
+
+		require.Nil(t, Set(m, "person", person{Email: "jane@example.com"}))
+
+		var actual person
+		require.Nil(t, Get(m, "person", &actual))
+		require.Equal(t, "jane@example.com", actual.Email)
+
+		require.Nil(t, SetNotFound(m, "absent"))
+		require.Equal(t, ErrCachedNotFound, Get(m, "absent", &actual))
+
+		require.Equal(t, "memory_cache", HealthCheck(ec).Data["cacheType"])
+	})
+
+	t.Run("Key Rotation", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+
+		before, err := NewEncryptedCache(mc, oldKey)
+		require.Nil(t, err)
+		require.Nil(t, before.Set(m, "rotated", "value"))
+
+		after, err := NewEncryptedCache(mc, newKey, oldKey)
+		require.Nil(t, err)
+
+		val, err := after.Get(m, "rotated")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		// Values written after rotation use the new key, and can't be read without it.
+		require.Nil(t, after.Set(m, "rotated", "value"))
+		_, err = before.Get(m, "rotated")
+		require.Equal(t, ErrUnknownKey, err)
+	})
+
+	t.Run("Bound To Key", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		ec, err := NewEncryptedCache(mc, newKey)
+		require.Nil(t, err)
+
+		require.Nil(t, ec.Set(m, "original", "value"))
+		stored, err := mc.Get(m, "original")
+		require.Nil(t, err)
+		require.Nil(t, mc.Set(m, "copy", stored))
+
+		_, err = ec.Get(m, "copy")
+		require.Equal(t, ErrDecrypt, err)
+	})
+
+	t.Run("Rejects Unencrypted Values", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		ec, err := NewEncryptedCache(mc, newKey)
+		require.Nil(t, err)
+
+		require.Nil(t, mc.Set(m, "plain", "value"))
+		_, err = ec.Get(m, "plain")
+		require.Equal(t, ErrDecrypt, err)
+
+		_, err = ec.Get(m, "missing")
+		require.Equal(t, ErrNotFound, err)
+
+		require.Equal(t, ErrUnsupportedType, ec.Set(m, "number", 10))
+	})
+
+	t.Run("Invalid Keys", func(t *testing.T) {
+		_, err := NewEncryptedCache(NewMemoryCache(time.Minute), EncryptionKey{ID: "short", Key: []byte("short")})
+		require.NotNil(t, err)
+
+		_, err = NewEncryptedCache(NewMemoryCache(time.Minute), EncryptionKey{ID: "a:b", Key: newKey.Key})
+		require.NotNil(t, err)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute)
+		ec, err := NewEncryptedCache(mc, newKey)
+		require.Nil(t, err)
+
+		require.Nil(t, ec.SetWithTags(m, "tagged", "value", time.Minute, "group"))
+		require.Nil(t, ec.InvalidateTag(m, "group"))
+
+		_, err = ec.Get(m, "tagged")
+		require.Equal(t, ErrNotFound, err)
+
+		bounded, err := NewEncryptedCache(NewBoundedCache(BoundedOptions{}), newKey)
+		require.Nil(t, err)
+		require.Equal(t, ErrTagsUnsupported, bounded.SetWithTags(m, "tagged", "value", time.Minute, "group"))
+	})
+	t.Run("Redis Pass Through", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		ec, err := NewEncryptedCache(redis.New(mr.Addr(), time.Second, "encrypted_test"), newKey)
+		require.Nil(t, err)
+
+		// Batches are encrypted per value.
+		require.Nil(t, ec.SetMany(m, map[string]interface{}{"a": "alpha", "b": "beta"}, time.Minute))
+
+		stored, err := mr.Get("a")
+		require.Nil(t, err)
+		require.NotContains(t, stored, "alpha")
+
+		vals, errs := ec.GetMany(m, []string{"a", "b", "missing"})
+		require.Equal(t, map[string]interface{}{"a": "alpha", "b": "beta"}, vals)
+		require.Len(t, errs, 1)
+		require.NotNil(t, errs["missing"])
+
+		require.Nil(t, ec.DeleteMany(m, []string{"a", "b"}))
+		require.False(t, mr.Exists("a"))
+
+		// Contexts reach the redis client.
+		ctx := context.Background()
+		require.Nil(t, ec.SetContext(ctx, "ctx", "value"))
+		val, err := ec.GetContext(ctx, "ctx")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = ec.GetContext(canceled, "ctx")
+		require.ErrorIs(t, err, context.Canceled)
+
+		// Locks are taken in redis, so DistributedLoad still coordinates.
+		lock, err := ec.TryLock(ctx, "locked", time.Minute)
+		require.Nil(t, err)
+		_, err = ec.TryLock(ctx, "locked", time.Minute)
+		require.Equal(t, redis.ErrLockHeld, err)
+		require.Nil(t, lock.Unlock(ctx))
+	})
+
+	t.Run("Memory Pass Through", func(t *testing.T) {
+		ec, err := NewEncryptedCache(NewBoundedCache(BoundedOptions{DefaultTTL: time.Minute}), newKey)
+		require.Nil(t, err)
+
+		require.Nil(t, ec.SetMany(m, map[string]interface{}{"a": "alpha"}, time.Minute))
+		vals, errs := ec.GetMany(m, []string{"a", "missing"})
+		require.Equal(t, map[string]interface{}{"a": "alpha"}, vals)
+		require.Equal(t, ErrNotFound, errs["missing"])
+
+		_, err = ec.TryLock(context.Background(), "locked", time.Minute)
+		require.Equal(t, errLocksUnsupported, err)
+	})
+}
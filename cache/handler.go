@@ -1,19 +1,38 @@
 package cache
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/btm6084/utilities/logging"
 	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/response"
 	"github.com/spf13/cast"
 )
 
+// refreshKey marks a request context for the middleware to render and store a fresh response,
+// regardless of what is cached.
+const refreshKey contextKey = "refresh"
+
 var (
+	// errUncacheable is returned from a load when the rendered response may not be cached.
+	errUncacheable = errors.New("response is not cacheable")
+
+	// errServedStale is returned from a load when the response failed, and a stale one was served instead.
+	errServedStale = errors.New("response failed, stale response served")
+
 	forbiddenHeaders = map[string]bool{
 		"Access-Control-Allow-Credentials": true,
 		"Access-Control-Allow-Headers":     true,
@@ -21,12 +40,140 @@ var (
 		"Access-Control-Allow-Origin":      true,
 		"X-Cache-Hit":                      true,
 	}
+
+	// revalidating tracks keys with a background refresh in progress.
+	revalidating sync.Map
+
+	// DefaultMaxBodySize is the largest response body cached by the middleware when
+	// MiddlewareOptions.MaxBodySize is zero.
+	DefaultMaxBodySize int64 = 10 << 20
+
+	// DefaultCacheableStatuses are the response status codes cached by the middleware when
+	// MiddlewareOptions.CacheableStatuses is empty.
+	DefaultCacheableStatuses = []int{
+		http.StatusOK,
+		http.StatusNonAuthoritativeInfo,
+		http.StatusNoContent,
+		http.StatusPartialContent,
+		http.StatusMultipleChoices,
+		http.StatusMovedPermanently,
+		http.StatusPermanentRedirect,
+	}
 )
 
 type CacheEvent struct {
 	Content    string      `json:"content"`
 	StatusCode int         `json:"statusCode"`
 	Headers    http.Header `json:"headers"`
+
+	// Compressed holds the body, compressed with Encoding, in place of Content. Compressed events
+	// are stored with MsgpackCodec, which keeps the body as binary rather than base64 encoding it.
+	Compressed []byte `json:"compressed,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+
+	// Expires is the time, in unix milliseconds, at which the response becomes stale. Events
+	// cached before expiry was recorded have no Expires, and are always considered fresh.
+	Expires int64 `json:"expires,omitempty"`
+
+	// Tags were attached by the handler with AddTags, and allow the response to be removed with InvalidateTag.
+	Tags []string `json:"tags,omitempty"`
+
+	// Vary is set in place of a response when responses vary by these request headers. Each
+	// variant is stored under its own key. See variantKey.
+	Vary []string `json:"vary,omitempty"`
+
+	// ETag and LastModified identify the response for conditional requests. They're taken from the
+	// response when the handler set them, and otherwise computed when the response is stored.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	// ttl is how long the event is stored for.
+	ttl time.Duration
+}
+
+func (ce CacheEvent) cacheTags() []string {
+	return ce.Tags
+}
+
+func (ce CacheEvent) cacheTTL() time.Duration {
+	return ce.ttl
+}
+
+func (ce CacheEvent) cacheCodec() Codec {
+	if ce.Encoding != "" {
+		return MsgpackCodec{}
+	}
+
+	// RawCodec only stores strings and bytes, so events are stored as JSON instead.
+	if _, ok := defaultCodec.(RawCodec); ok {
+		return JSONCodec{}
+	}
+
+	return defaultCodec
+}
+
+func (ce CacheEvent) lastModified() time.Time {
+	t, _ := http.ParseTime(ce.LastModified)
+	return t
+}
+
+// isVaryIndex reports whether the event lists the headers that select a variant, rather than
+// holding a response.
+func (ce CacheEvent) isVaryIndex() bool {
+	return len(ce.Vary) > 0
+}
+
+// staleness reports how long ago the event stopped being fresh. Negative while still fresh.
+func (ce CacheEvent) staleness(now time.Time) time.Duration {
+	if ce.Expires == 0 {
+		return -1
+	}
+
+	return now.Sub(time.UnixMilli(ce.Expires))
+}
+
+// MiddlewareOptions configures an instance of the cache middleware.
+type MiddlewareOptions struct {
+	// Duration is how long a cached response is served as fresh.
+	Duration time.Duration
+
+	// ExcludedPaths are path prefixes that are never cached.
+	ExcludedPaths []string
+
+	// StaleWhileRevalidate is how long after becoming stale a cached response may still be served,
+	// while a fresh response is rendered in the background.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is how long after becoming stale a cached response may still be served in place
+	// of a 5xx response or panic from the handler.
+	StaleIfError time.Duration
+
+	// KeyFunc returns the cache key for a request. Defaults to DefaultKeyBuilder, which for
+	// HandlerWrapper also includes the requested host.
+	KeyFunc KeyFunc
+
+	// CacheableStatuses are the response status codes that may be cached. Defaults to
+	// DefaultCacheableStatuses. 5xx responses are never cached.
+	CacheableStatuses []int
+
+	// CacheNotFound allows 404 responses to be cached, for NotFoundTTL unless the response's
+	// Cache-Control header says otherwise.
+	CacheNotFound bool
+
+	// CacheCookies allows responses that set cookies to be cached. The cookies are replayed to every
+	// client served the cached response.
+	CacheCookies bool
+
+	// MaxBodySize is the largest response body, in bytes, that is cached. Larger responses are passed
+	// through to the client without being buffered. Defaults to DefaultMaxBodySize; negative is unlimited.
+	MaxBodySize int64
+
+	// Compression, if set, stores response bodies compressed with CompressionGzip or CompressionDeflate.
+	// Compressed bodies are served as stored to clients that accept the encoding.
+	Compression string
+
+	// CompressionMinSize is the smallest response body, in bytes, that is compressed.
+	CompressionMinSize int
 }
 
 // ResponseWriterTee captures input to an http.ResponseWriter
@@ -34,6 +181,31 @@ type ResponseWriterTee struct {
 	Buffer     bytes.Buffer
 	StatusCode int
 	w          http.ResponseWriter
+
+	// holdErrors withholds 5xx responses from w, so that a stale response can be served instead.
+	holdErrors bool
+	held       bool
+
+	// maxBody is the most bytes buffered, if positive. Once the body exceeds it, or the connection is
+	// hijacked, the tee stops buffering and passthrough is set.
+	maxBody     int64
+	passthrough bool
+
+	// sent is set once the response header is written to w. Until the response streams, or send is
+	// called, the header and buffered body are held back, so that headers computed from the whole
+	// body, such as ETag, can still be added.
+	sent bool
+
+	// hijacked is set once the handler takes over the connection, after which nothing more may be
+	// written through w.
+	hijacked bool
+
+	// onHeader is called with the status code before the response header is written.
+	onHeader func(statusCode int)
+
+	// onStream is called once the response starts streaming to the client rather than being buffered
+	// whole: when the tee stops buffering, or the handler flushes.
+	onStream func()
 }
 
 // Header proxies http.ResponseWriter Header
@@ -43,116 +215,580 @@ func (w *ResponseWriterTee) Header() http.Header {
 
 // WriteHeader proxies http.ResponseWriter WriteHeader
 func (w *ResponseWriterTee) WriteHeader(statusCode int) {
+	if w.StatusCode == 0 && w.onHeader != nil {
+		w.onHeader(statusCode)
+	}
+
 	w.StatusCode = statusCode
-	w.w.WriteHeader(statusCode)
+	if w.holdErrors && statusCode >= 500 {
+		w.held = true
+		return
+	}
+
+	if w.passthrough {
+		w.send()
+	}
 }
 
 // Write proxies http.ResponseWriter Write
 func (w *ResponseWriterTee) Write(b []byte) (int, error) {
-	w.Buffer.Write(b)
+	if w.StatusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.buffer(b)
+	if w.held || !w.sent {
+		return len(b), nil
+	}
+
 	return w.w.Write(b)
 }
 
+// buffer captures b, until the body grows beyond maxBody.
+func (w *ResponseWriterTee) buffer(b []byte) {
+	if w.passthrough {
+		return
+	}
+
+	if w.maxBody > 0 && int64(w.Buffer.Len()+len(b)) > w.maxBody {
+		w.stopBuffering()
+		return
+	}
+
+	w.Buffer.Write(b)
+}
+
+// stopBuffering sends the buffered body, and passes the rest of the response through uncached.
+func (w *ResponseWriterTee) stopBuffering() {
+	w.send()
+	w.passthrough = true
+	w.Buffer = bytes.Buffer{}
+	w.streaming()
+}
+
+// streaming calls onStream the first time the response streams to the client.
+func (w *ResponseWriterTee) streaming() {
+	if w.onStream == nil || w.held {
+		return
+	}
+
+	w.onStream()
+	w.onStream = nil
+}
+
+// Flush proxies http.Flusher Flush, if the underlying ResponseWriter supports it.
+func (w *ResponseWriterTee) Flush() {
+	if w.StatusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.streaming()
+	w.send()
+	if f, ok := w.w.(http.Flusher); ok && !w.held {
+		f.Flush()
+	}
+}
+
+// Hijack proxies http.Hijacker Hijack, if the underlying ResponseWriter supports it. A hijacked
+// response is not cached.
+func (w *ResponseWriterTee) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	w.stopBuffering()
+	w.hijacked = true
+	return h.Hijack()
+}
+
+// ReadFrom proxies io.ReaderFrom ReadFrom. Once the body is no longer buffered, it's handed to the
+// underlying ResponseWriter, allowing it to use optimizations such as sendfile.
+func (w *ResponseWriterTee) ReadFrom(r io.Reader) (int64, error) {
+	if w.StatusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if rf, ok := w.w.(io.ReaderFrom); ok && w.passthrough && !w.held {
+		return rf.ReadFrom(r)
+	}
+
+	// Hide ReadFrom from io.Copy, which would otherwise call it again.
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+// Unwrap returns the underlying ResponseWriter, for use by http.ResponseController.
+func (w *ResponseWriterTee) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
+// send writes the held back header, and the body buffered so far, to w.
+func (w *ResponseWriterTee) send() {
+	if w.sent || w.held || w.StatusCode == 0 {
+		return
+	}
+
+	w.sent = true
+	w.w.WriteHeader(w.StatusCode)
+	if w.Buffer.Len() > 0 {
+		w.w.Write(w.Buffer.Bytes())
+	}
+}
+
+// committed reports whether any part of the response has been sent to the client.
+func (w *ResponseWriterTee) committed() bool {
+	return w.sent
+}
+
 // Middleware provides a cache-layer middleware for caching the input/output for GET requests.
 func Middleware(cacheDuration int, excludedPaths []string) func(http.Handler) http.Handler {
-	d := time.Duration(cacheDuration) * time.Second
+	return NewMiddleware(MiddlewareOptions{
+		Duration:      time.Duration(cacheDuration) * time.Second,
+		ExcludedPaths: excludedPaths,
+	})
+}
 
+// NewMiddleware provides a cache-layer middleware for caching the input/output for GET requests,
+// configured by opts.
+func NewMiddleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		h := newCacheHandler(opts, next, DefaultKeyBuilder)
+
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !Enabled || r.Method != "GET" || excludedFromCache(r, excludedPaths) || cast.ToBool(r.URL.Query().Get("noCache")) {
+			if !Enabled || r.Method != "GET" || excludedFromCache(r, opts.ExcludedPaths) || cast.ToBool(r.URL.Query().Get("noCache")) {
 				next.ServeHTTP(w, r)
 				w.Header().Set("Cache-Control", "no-cache")
 				return
 			}
 
-			key := r.Method + r.RequestURI + r.Header.Get("range")
-			m := metrics.GetRecorder(r.Context())
-
-			if handlerTryCache(w, r, m, key, d) {
-				return
-			}
-
-			handleCacheableRequest(next, w, r, m, key, d)
+			h.ServeHTTP(w, r)
 		})
 	}
 }
 
 // HandlerWrapper provices a cache-layer wrapper for a single API route.
 func HandlerWrapper(cacheDuration int, next http.Handler) http.HandlerFunc {
-	d := time.Duration(cacheDuration) * time.Second
+	return NewHandlerWrapper(MiddlewareOptions{Duration: time.Duration(cacheDuration) * time.Second}, next)
+}
+
+// NewHandlerWrapper provides a cache-layer wrapper for a single API route, configured by opts.
+// Unlike Middleware, cache keys include the requested host.
+func NewHandlerWrapper(opts MiddlewareOptions, next http.Handler) http.HandlerFunc {
+	keys := DefaultKeyBuilder
+	keys.IncludeHost = true
+	h := newCacheHandler(opts, next, keys)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if !Enabled || r.Method != "GET" || cast.ToBool(r.URL.Query().Get("noCache")) {
+		if !Enabled || r.Method != "GET" || excludedFromCache(r, opts.ExcludedPaths) || cast.ToBool(r.URL.Query().Get("noCache")) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		m := metrics.GetRecorder(r.Context())
-		host, _, err := net.SplitHostPort(r.Host)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// cacheHandler serves cacheable requests for a single middleware instance.
+type cacheHandler struct {
+	opts MiddlewareOptions
+	next http.Handler
+	key  KeyFunc
+}
+
+// newCacheHandler returns a cacheHandler keying requests by opts.KeyFunc, or by keys if there is none.
+func newCacheHandler(opts MiddlewareOptions, next http.Handler, keys KeyBuilder) *cacheHandler {
+	key := opts.KeyFunc
+	if key == nil {
+		key = keys.Key
+	}
+
+	return &cacheHandler{opts: opts, next: next, key: key}
+}
+
+// ServeHTTP serves the request from cache, or renders it with next and caches the response.
+func (h *cacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if refresh, _ := r.Context().Value(refreshKey).(bool); refresh {
+		h.refresh(w, r, h.key(r))
+		return
+	}
+
+	h.serve(w, r, h.key(r))
+}
+
+// refresh renders and stores the response for key, without regard for what is already cached. If a
+// load of key is already in progress, nothing is written to w.
+func (h *cacheHandler) refresh(w http.ResponseWriter, r *http.Request, key string) {
+	load(r.Context(), key, h.ttl(h.opts.Duration), h.loader(w, r, key, nil), func(string) bool { return false })
+}
+
+// serve serves the response cached under key, following a Vary index to the variant for r. Cache
+// operations are abandoned if the request is canceled.
+func (h *cacheHandler) serve(w http.ResponseWriter, r *http.Request, key string) {
+	var ce CacheEvent
+	if err := GetContext(r.Context(), key, &ce); err != nil {
+		h.serveMiss(w, r, key, nil)
+		return
+	}
+
+	if ce.isVaryIndex() {
+		h.serve(w, r, variantKey(key, ce.Vary, r))
+		return
+	}
+
+	staleness := ce.staleness(time.Now())
+	switch {
+	case staleness < 0:
+		writeCacheEvent(w, r, ce, "true", h.opts.Duration)
+	case staleness < h.opts.StaleWhileRevalidate:
+		writeCacheEvent(w, r, ce, "STALE", 0)
+		h.revalidate(r, key)
+	case staleness < h.opts.StaleIfError:
+		h.serveMiss(w, r, key, &ce)
+	default:
+		h.serveMiss(w, r, key, nil)
+	}
+}
+
+// serveMiss renders the response and caches it. Concurrent misses for the same key are coalesced,
+// so that only one request renders the response while the others wait and replay it. A response
+// streamed to the client releases the waiting requests to render their own. If stale is provided,
+// it is served in place of a failed response, both to the request that rendered it and to those
+// that waited on it.
+func (h *cacheHandler) serveMiss(w http.ResponseWriter, r *http.Request, key string, stale *CacheEvent) {
+	render := h.loader(w, r, key, stale)
+
+	rendered := false
+	raw, err := load(r.Context(), key, h.ttl(h.opts.Duration), func(release func()) (interface{}, error) {
+		rendered = true
+		return render(release)
+	}, freshEvent)
+
+	if rendered {
+		return
+	}
+
+	// The response failed for the request we waited on, and would likely fail for us too.
+	if stale != nil && (err == errServedStale || err == errLoadPanicked) {
+		writeCacheEvent(w, r, *stale, "STALE", 0)
+		return
+	}
+
+	var ce CacheEvent
+	if err == nil {
+		err = decode(raw, &ce)
+	}
+
+	// The response could not be shared, so we render our own.
+	if err != nil {
+		if v, err := render(func() {}); err == nil {
+			own := v.(CacheEvent)
+			setTagged(r.Context(), key, own, own.ttl, own.Tags)
+		}
+		return
+	}
+
+	if ce.isVaryIndex() {
+		h.serve(w, r, variantKey(key, ce.Vary, r))
+		return
+	}
+
+	writeCacheEvent(w, r, ce, "true", h.opts.Duration)
+}
+
+// revalidate renders a fresh response for key in the background. Only one refresh per key runs at a time.
+func (h *cacheHandler) revalidate(r *http.Request, key string) {
+	if _, running := revalidating.LoadOrStore(key, true); running {
+		return
+	}
+
+	req := r.Clone(metrics.ContextWithRecorder(detachedContext{r.Context()}, &metrics.NoOp{}))
+
+	go func() {
+		defer revalidating.Delete(key)
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("cache: background refresh of %s panicked: %v\n", key, p)
+			}
+		}()
+
+		load(req.Context(), key, h.ttl(h.opts.Duration), h.loader(&discardWriter{header: http.Header{}}, req, key, nil), freshEvent)
+	}()
+}
+
+// loader returns a function that renders the response to be cached under key. A response that varies
+// by request headers is stored under the key for its variant, and if key is the primary key for the
+// request, an index of the headers it varies by is returned to be cached under key instead. release
+// is called if the response streams to the client.
+func (h *cacheHandler) loader(w http.ResponseWriter, r *http.Request, key string, stale *CacheEvent) func(release func()) (interface{}, error) {
+	return func(release func()) (interface{}, error) {
+		ce, err := h.render(w, r, stale, release)
 		if err != nil {
-			host = strings.Trim(r.Host, `"' ,`)
+			return nil, err
 		}
 
-		key := host + r.Method + r.RequestURI + r.Header.Get("range")
+		vary := varyHeaders(ce.Headers)
+		if len(vary) == 0 || key != h.key(r) {
+			return ce, nil
+		}
 
-		if handlerTryCache(w, r, m, key, d) {
-			return
+		if err := setTagged(r.Context(), variantKey(key, vary, r), ce, ce.ttl, ce.Tags); err != nil {
+			return nil, err
 		}
 
-		handleCacheableRequest(next, w, r, m, key, d)
-	})
+		return CacheEvent{Vary: vary, Tags: ce.Tags, ttl: ce.ttl}, nil
+	}
 }
 
-func handlerTryCache(w http.ResponseWriter, r *http.Request, m metrics.Recorder, key string, d time.Duration) bool {
+// render serves the request with next, capturing the response. Returns errUncacheable if the
+// response should not be cached. If stale is provided, it is served in place of a 5xx response or a
+// panic, and errServedStale is returned. onStream is called if the response streams to the client
+// rather than being buffered whole.
+func (h *cacheHandler) render(w http.ResponseWriter, r *http.Request, stale *CacheEvent, onStream func()) (ce CacheEvent, err error) {
+	writer := ResponseWriterTee{w: w, holdErrors: stale != nil, maxBody: h.maxBodySize(), onStream: onStream}
+	w.Header().Set("X-Cache-Hit", "false")
 
-	var ce CacheEvent
-	if err := Get(m, key, &ce); err == nil {
-		// Retain any headers.
-		for k, v := range ce.Headers {
-			if forbiddenHeader(k) {
-				continue
+	// Whether the response may be cached is decided by the header the handler writes, and
+	// reflected in the Cache-Control header unless the handler set its own.
+	var fresh time.Duration
+	cacheable := false
+	writer.onHeader = func(statusCode int) {
+		fresh, cacheable = h.policy(w.Header(), statusCode)
+
+		switch {
+		case w.Header().Get("Cache-Control") != "":
+		case cacheable:
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", int(fresh/time.Second)))
+		default:
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+	}
+
+	req := logging.RequestWithCacheStatus(r, false)
+	if r != nil && req != nil {
+		*r = *req
+	}
+
+	ctx, tags := contextWithTagCollector(r.Context())
+	r = r.WithContext(ctx)
+
+	if stale != nil {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
 			}
 
-			for i := 0; i < len(v); i++ {
-				w.Header().Set(k, v[i])
+			// Part of the failed response was already sent; there's nothing left to recover.
+			if writer.committed() {
+				panic(p)
+			}
+
+			log.Printf("cache: serving stale response after panic: %v\n", p)
+			writeCacheEvent(w, r, *stale, "STALE", 0)
+			ce, err = CacheEvent{}, errServedStale
+		}()
+	}
+
+	h.next.ServeHTTP(&writer, r)
+
+	// The handler took over the connection, and is responsible for anything sent on it.
+	if writer.hijacked {
+		return CacheEvent{}, errUncacheable
+	}
+
+	if writer.StatusCode == 0 {
+		writer.WriteHeader(http.StatusOK)
+	}
+
+	if writer.held {
+		writeCacheEvent(w, r, *stale, "STALE", 0)
+		return CacheEvent{}, errServedStale
+	}
+
+	// The ETag of a buffered response is sent with it too, unless it was already flushed, so that
+	// clients can revalidate it before it's served from cache.
+	etag := w.Header().Get("ETag")
+	if etag == "" && cacheable && !writer.passthrough {
+		etag = response.ETag(writer.Buffer.Bytes())
+		if !writer.sent {
+			w.Header().Set("ETag", etag)
+		}
+	}
+
+	writer.send()
+	if !cacheable || writer.passthrough {
+		return CacheEvent{}, errUncacheable
+	}
+
+	lastModified := w.Header().Get("Last-Modified")
+	if lastModified == "" {
+		lastModified = time.Now().UTC().Format(http.TimeFormat)
+	}
+
+	ce = CacheEvent{
+		Content:      writer.Buffer.String(),
+		Headers:      w.Header(),
+		StatusCode:   writer.StatusCode,
+		Expires:      time.Now().Add(fresh).UnixMilli(),
+		Tags:         tags.list(),
+		ETag:         etag,
+		LastModified: lastModified,
+		ttl:          h.ttl(fresh),
+	}
+
+	// Bodies the handler already encoded are stored as they are.
+	if h.opts.Compression != "" && len(ce.Content) >= h.opts.CompressionMinSize && w.Header().Get("Content-Encoding") == "" {
+		if err := ce.compress(h.opts.Compression); err != nil {
+			log.Printf("cache: unable to compress response: %s\n", err)
+			return CacheEvent{}, errUncacheable
+		}
+	}
+
+	return ce, nil
+}
+
+// policy reports whether a response with the given status and header may be cached, and how long
+// it remains fresh. Freshness is taken from the s-maxage or max-age directives when present.
+func (h *cacheHandler) policy(header http.Header, statusCode int) (time.Duration, bool) {
+	notFound := statusCode == http.StatusNotFound && h.opts.CacheNotFound
+	if statusCode >= 500 || !(notFound || h.cacheableStatus(statusCode)) {
+		return 0, false
+	}
+
+	if len(header.Values("Set-Cookie")) > 0 && !h.opts.CacheCookies {
+		return 0, false
+	}
+
+	if contains(varyHeaders(header), "*") {
+		return 0, false
+	}
+
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0, false
+		}
+	}
+
+	fresh := h.opts.Duration
+	if notFound {
+		fresh = NotFoundTTL
+	}
+
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, false
 			}
+
+			fresh = time.Duration(secs) * time.Second
+			break
 		}
+	}
+
+	return fresh, fresh > 0
+}
+
+func (h *cacheHandler) maxBodySize() int64 {
+	if h.opts.MaxBodySize == 0 {
+		return DefaultMaxBodySize
+	}
 
-		w.Header().Set("X-Cache-Hit", "true")
-		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", int(d/time.Second)))
-		w.WriteHeader(ce.StatusCode)
-		w.Write([]byte(ce.Content))
-		return true
+	return h.opts.MaxBodySize
+}
+
+func (h *cacheHandler) cacheableStatus(statusCode int) bool {
+	statuses := h.opts.CacheableStatuses
+	if len(statuses) == 0 {
+		statuses = DefaultCacheableStatuses
+	}
+
+	for _, s := range statuses {
+		if s == statusCode {
+			return true
+		}
 	}
 
 	return false
 }
 
-func handleCacheableRequest(next http.Handler, w http.ResponseWriter, r *http.Request, m metrics.Recorder, key string, d time.Duration) {
-	writer := ResponseWriterTee{w: w}
-	w.Header().Set("X-Cache-Hit", "false")
-	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", int(d/time.Second)))
+// ttl is how long a response fresh for the given duration is kept in cache, including the time it
+// may be served stale.
+func (h *cacheHandler) ttl(fresh time.Duration) time.Duration {
+	if h.opts.StaleIfError > h.opts.StaleWhileRevalidate {
+		return fresh + h.opts.StaleIfError
+	}
 
-	req := logging.RequestWithCacheStatus(r, false)
-	if r != nil && req != nil {
-		*r = *req
+	return fresh + h.opts.StaleWhileRevalidate
+}
+
+// writeCacheEvent replays a cached response, or answers a conditional request for it with 304 Not Modified.
+// hit populates the X-Cache-Hit header, and maxAge the max-age sent with stale responses.
+func writeCacheEvent(w http.ResponseWriter, r *http.Request, ce CacheEvent, hit string, maxAge time.Duration) {
+	// Retain any headers.
+	for k, v := range ce.Headers {
+		if forbiddenHeader(k) {
+			continue
+		}
+
+		// Replace, rather than append to, any value already set, keeping each of the cached values.
+		w.Header().Del(k)
+		for i := 0; i < len(v); i++ {
+			w.Header().Add(k, v[i])
+		}
 	}
 
-	next.ServeHTTP(&writer, r)
+	w.Header().Set("X-Cache-Hit", hit)
 
-	sc := writer.StatusCode
-	if sc >= 500 {
+	// Fresh responses keep the Cache-Control header they were stored with, so that hits send the
+	// same directives as the response that was cached. Stale responses, and those stored without
+	// one, are sent with maxAge instead.
+	if ce.staleness(time.Now()) >= 0 || w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public", int(maxAge/time.Second)))
+	}
+
+	body, encoding, err := ce.body(r)
+	if err != nil {
+		log.Printf("cache: unable to decompress cached response: %s\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	ce := CacheEvent{
-		Content:    writer.Buffer.String(),
-		Headers:    w.Header(),
-		StatusCode: writer.StatusCode,
+	if ce.Encoding != "" {
+		if !contains(varyHeaders(w.Header()), "Accept-Encoding") {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		w.Header().Del("Content-Length")
 	}
 
-	SetWithDuration(m, key, ce, d)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
+	etag := representationETag(ce.ETag, encoding)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	if ce.LastModified != "" {
+		w.Header().Set("Last-Modified", ce.LastModified)
+	}
+
+	if ce.StatusCode/100 == 2 && response.NotModified(r, etag, ce.lastModified()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(ce.StatusCode)
+	w.Write(body)
+}
+
+// freshEvent reports whether raw holds a CacheEvent that has not yet gone stale.
+func freshEvent(raw string) bool {
+	var ce CacheEvent
+	return decode(raw, &ce) == nil && ce.staleness(time.Now()) < 0
 }
 
 func excludedFromCache(r *http.Request, excludePaths []string) bool {
@@ -169,3 +805,54 @@ func forbiddenHeader(k string) bool {
 	_, isset := forbiddenHeaders[k]
 	return isset
 }
+
+// varyHeaders returns the canonical names of the request headers listed by the Vary response header.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			if name != "" && !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// variantKey returns the key for the variant of the response cached at key selected by r's values
+// for the vary headers.
+func variantKey(key string, vary []string, r *http.Request) string {
+	var values strings.Builder
+	for _, name := range vary {
+		values.WriteString(name + ":" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+
+	return key + "|vary#" + hash(values.String())
+}
+
+// parseCacheControl returns the directives of Cache-Control header values, by lowercase name.
+func parseCacheControl(values []string) map[string]string {
+	directives := map[string]string{}
+	for _, v := range values {
+		for _, d := range strings.Split(v, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+
+	return directives
+}
+
+// discardWriter is an http.ResponseWriter that discards everything written to it.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,714 @@
+package cache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/response"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Caches Responses", func(t *testing.T) {
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		}))
+
+		for i, hit := range []string{"false", "true"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/caches?i=1", nil))
+
+			require.Equal(t, http.StatusOK, w.Code, i)
+			require.Equal(t, "hello", w.Body.String())
+			require.Equal(t, hit, w.Header().Get("X-Cache-Hit"))
+			require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		}
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Caches Under RawCodec", func(t *testing.T) {
+		InitializeWithCodec(NewMemoryCache(time.Minute), time.Minute, RawCodec{})
+		defer Initialize(NewMemoryCache(5*time.Minute), 0)
+
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Write([]byte("raw"))
+		}))
+
+		for i, hit := range []string{"false", "true"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw", nil))
+
+			require.Equal(t, "raw", w.Body.String(), i)
+			require.Equal(t, hit, w.Header().Get("X-Cache-Hit"))
+		}
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Coalesces Concurrent Misses", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{
+			Duration:          time.Minute,
+			CacheableStatuses: []int{http.StatusAccepted},
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("rendered once"))
+		}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/coalesce", nil))
+				require.Equal(t, http.StatusAccepted, w.Code)
+				require.Equal(t, "rendered once", w.Body.String())
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Server Errors Are Not Cached", func(t *testing.T) {
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/errors", nil))
+			require.Equal(t, http.StatusBadGateway, w.Code)
+		}
+
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestMiddlewareStale(t *testing.T) {
+	t.Run("Stale While Revalidate", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{
+			Duration:             100 * time.Millisecond,
+			StaleWhileRevalidate: time.Minute,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			w.Write([]byte(fmt.Sprintf("version %d", n)))
+		}))
+
+		serve := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swr", nil))
+			return w
+		}
+
+		require.Equal(t, "version 1", serve().Body.String())
+		time.Sleep(150 * time.Millisecond)
+
+		w := serve()
+		require.Equal(t, "version 1", w.Body.String())
+		require.Equal(t, "STALE", w.Header().Get("X-Cache-Hit"))
+
+		require.Eventually(t, func() bool {
+			w := serve()
+			return w.Body.String() == "version 2" && w.Header().Get("X-Cache-Hit") == "true"
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Stale If Error", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{
+			Duration:     100 * time.Millisecond,
+			StaleIfError: time.Minute,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch atomic.AddInt32(&calls, 1) {
+			case 1:
+				w.Write([]byte("good"))
+			case 2:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("bad"))
+			default:
+				panic("worse")
+			}
+		}))
+
+		serve := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sie", nil))
+			return w
+		}
+
+		require.Equal(t, "good", serve().Body.String())
+		time.Sleep(150 * time.Millisecond)
+
+		// Both the 500 and the panic are replaced by the stale response.
+		for i := 0; i < 2; i++ {
+			w := serve()
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, "good", w.Body.String())
+			require.Equal(t, "STALE", w.Header().Get("X-Cache-Hit"))
+		}
+
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Stale If Error Coalesced", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{
+			Duration:     100 * time.Millisecond,
+			StaleIfError: time.Minute,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Write([]byte("good"))
+				return
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sie-coalesced", nil))
+		require.Equal(t, "good", w.Body.String())
+
+		time.Sleep(150 * time.Millisecond)
+
+		// Requests waiting on the failed render are served the stale response, rather than each
+		// rendering against the failing handler.
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sie-coalesced", nil))
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, "good", w.Body.String())
+				require.Equal(t, "STALE", w.Header().Get("X-Cache-Hit"))
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Stale If Error Expires", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{
+			Duration:     50 * time.Millisecond,
+			StaleIfError: 50 * time.Millisecond,
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Write([]byte("good"))
+				return
+			}
+
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sie-expires", nil))
+		require.Equal(t, "good", w.Body.String())
+
+		time.Sleep(150 * time.Millisecond)
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sie-expires", nil))
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestMiddlewareDirectives(t *testing.T) {
+	serve := func(h http.Handler, target string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	uncached := []struct {
+		name   string
+		target string
+		handle func(w http.ResponseWriter)
+	}{
+		{"No Store", "/no-store", func(w http.ResponseWriter) { w.Header().Set("Cache-Control", "no-store") }},
+		{"Private", "/private", func(w http.ResponseWriter) { w.Header().Set("Cache-Control", "private, max-age=60") }},
+		{"Max Age Zero", "/max-age-zero", func(w http.ResponseWriter) { w.Header().Set("Cache-Control", "max-age=0") }},
+		{"Set Cookie", "/cookie", func(w http.ResponseWriter) { w.Header().Set("Set-Cookie", "session=secret") }},
+		{"Vary All", "/vary-all", func(w http.ResponseWriter) { w.Header().Set("Vary", "*") }},
+		{"Not Found", "/not-found", func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) }},
+	}
+
+	for _, tc := range uncached {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				tc.handle(w)
+				w.Write([]byte("uncached"))
+			}))
+
+			serve(h, tc.target)
+			w := serve(h, tc.target)
+			require.Equal(t, "false", w.Header().Get("X-Cache-Hit"))
+			require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		})
+	}
+
+	t.Run("Uncacheable Responses Are Marked", func(t *testing.T) {
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+
+		require.Equal(t, "no-cache", serve(h, "/marked").Header().Get("Cache-Control"))
+	})
+
+	t.Run("Cookies Opt In", func(t *testing.T) {
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, CacheCookies: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Set-Cookie", "shared=1")
+		}))
+
+		serve(h, "/cookie-opt-in")
+		w := serve(h, "/cookie-opt-in")
+		require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, "shared=1", w.Header().Get("Set-Cookie"))
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Multiple Cookies Replayed", func(t *testing.T) {
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, CacheCookies: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Set-Cookie", "first=1")
+			w.Header().Add("Set-Cookie", "second=2")
+		}))
+
+		serve(h, "/cookie-multiple")
+		w := serve(h, "/cookie-multiple")
+		require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, []string{"first=1", "second=2"}, w.Header().Values("Set-Cookie"))
+	})
+
+	t.Run("Not Found Opt In", func(t *testing.T) {
+		defer func(ttl time.Duration) { NotFoundTTL = ttl }(NotFoundTTL)
+		NotFoundTTL = 1 * time.Second
+
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Hour, CacheNotFound: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("missing"))
+		}))
+
+		w := serve(h, "/not-found-opt-in")
+		require.Equal(t, "max-age=1, public", w.Header().Get("Cache-Control"))
+
+		w = serve(h, "/not-found-opt-in")
+		require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Equal(t, "missing", w.Body.String())
+
+		time.Sleep(1100 * time.Millisecond)
+		require.Equal(t, "false", serve(h, "/not-found-opt-in").Header().Get("X-Cache-Hit"))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("S-Maxage Sets Freshness", func(t *testing.T) {
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Cache-Control", "public, max-age=3600, s-maxage=1")
+		}))
+
+		w := serve(h, "/s-maxage")
+		require.Equal(t, "public, max-age=3600, s-maxage=1", w.Header().Get("Cache-Control"))
+		require.Equal(t, "true", serve(h, "/s-maxage").Header().Get("X-Cache-Hit"))
+
+		time.Sleep(1100 * time.Millisecond)
+		require.Equal(t, "false", serve(h, "/s-maxage").Header().Get("X-Cache-Hit"))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Hits Replay Cache-Control", func(t *testing.T) {
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=30, s-maxage=10")
+		}))
+
+		for _, hit := range []string{"false", "true"} {
+			w := serve(h, "/replay-cache-control")
+			require.Equal(t, hit, w.Header().Get("X-Cache-Hit"))
+			require.Equal(t, "public, max-age=30, s-maxage=10", w.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("Vary", func(t *testing.T) {
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte("lang " + r.Header.Get("Accept-Language")))
+		}))
+
+		for i, tc := range []struct{ lang, hit string }{
+			{"en", "false"},
+			{"fr", "false"},
+			{"en", "true"},
+			{"fr", "true"},
+		} {
+			w := serve(h, "/vary", "Accept-Language", tc.lang)
+			require.Equal(t, "lang "+tc.lang, w.Body.String(), i)
+			require.Equal(t, tc.hit, w.Header().Get("X-Cache-Hit"), i)
+		}
+
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestMiddlewareConditional(t *testing.T) {
+	serve := func(h http.Handler, target string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Computed Validators", func(t *testing.T) {
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("conditional"))
+		}))
+
+		// The rendered response has the ETag it's cached with, so it can be revalidated right away.
+		w := serve(h, "/conditional")
+		require.Equal(t, "false", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, response.ETag([]byte("conditional")), w.Header().Get("ETag"))
+
+		w = serve(h, "/conditional")
+		etag := w.Header().Get("ETag")
+		lastModified := w.Header().Get("Last-Modified")
+		require.Equal(t, response.ETag([]byte("conditional")), etag)
+		require.NotEmpty(t, lastModified)
+
+		w = serve(h, "/conditional", "If-None-Match", etag)
+		require.Equal(t, http.StatusNotModified, w.Code)
+		require.Empty(t, w.Body.String())
+		require.Equal(t, etag, w.Header().Get("ETag"))
+
+		w = serve(h, "/conditional", "If-None-Match", `"something else"`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "conditional", w.Body.String())
+
+		w = serve(h, "/conditional", "If-Modified-Since", lastModified)
+		require.Equal(t, http.StatusNotModified, w.Code)
+
+		w = serve(h, "/conditional", "If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// If-None-Match takes precedence over If-Modified-Since.
+		w = serve(h, "/conditional", "If-None-Match", `"something else"`, "If-Modified-Since", lastModified)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Agrees With ServeETagJSON", func(t *testing.T) {
+		data := map[string]string{"hello": "world"}
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response.ServeETagJSON(w, r, http.StatusOK, data)
+		}))
+
+		w := serve(h, "/etag-json")
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		w = serve(h, "/etag-json")
+		require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, etag, w.Header().Get("ETag"))
+
+		// Tags sent back without quotes still match.
+		w = serve(h, "/etag-json", "If-None-Match", strings.Trim(etag, `"`))
+		require.Equal(t, http.StatusNotModified, w.Code)
+	})
+}
+
+// streamWriter is an http.ResponseWriter that counts the bytes written to it, without retaining them.
+type streamWriter struct {
+	header  http.Header
+	code    int
+	written int64
+	flushes int
+}
+
+func (w *streamWriter) Header() http.Header         { return w.header }
+func (w *streamWriter) WriteHeader(code int)        { w.code = code }
+func (w *streamWriter) Write(b []byte) (int, error) { w.written += int64(len(b)); return len(b), nil }
+func (w *streamWriter) Flush()                      { w.flushes++ }
+
+// hijackWriter is a streamWriter whose connection may be hijacked.
+type hijackWriter struct {
+	streamWriter
+	conn net.Conn
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+func TestMiddlewareStreaming(t *testing.T) {
+	t.Run("Large Bodies Are Not Buffered", func(t *testing.T) {
+		const chunk, chunks = 32 << 10, 2048 // 64MiB
+
+		var calls int32
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, MaxBodySize: 1 << 20})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+
+			b := make([]byte, chunk)
+			for i := 0; i < chunks; i++ {
+				w.Write(b)
+				w.(http.Flusher).Flush()
+			}
+		}))
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		w := &streamWriter{header: http.Header{}}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+		runtime.ReadMemStats(&after)
+
+		require.Equal(t, int64(chunk*chunks), w.written)
+		require.Equal(t, chunks, w.flushes)
+		require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+
+		w = &streamWriter{header: http.Header{}}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+		require.Equal(t, "false", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Bodies Within Limit Are Cached", func(t *testing.T) {
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, MaxBodySize: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, strings.NewReader("12345678"))
+		}))
+
+		for _, hit := range []string{"false", "true"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/within-limit", nil))
+			require.Equal(t, "12345678", w.Body.String())
+			require.Equal(t, hit, w.Header().Get("X-Cache-Hit"))
+		}
+	})
+
+	t.Run("Hijack", func(t *testing.T) {
+		tee := &ResponseWriterTee{w: httptest.NewRecorder()}
+		_, _, err := tee.Hijack()
+		require.Equal(t, http.ErrNotSupported, err)
+
+		srv := httptest.NewServer(Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			require.Nil(t, err)
+			defer conn.Close()
+
+			buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			buf.Flush()
+		})))
+		defer srv.Close()
+
+		for i := 0; i < 2; i++ {
+			rsp, err := http.Get(srv.URL + "/hijack")
+			require.Nil(t, err)
+			b, _ := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			require.Equal(t, "hijacked", string(b))
+			require.Empty(t, rsp.Header.Get("X-Cache-Hit"))
+		}
+
+		// Nothing is written through a hijacked ResponseWriter, or cached.
+		client, server := net.Pipe()
+		defer client.Close()
+
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.Nil(t, err)
+			conn.Close()
+		}))
+
+		w := &hijackWriter{streamWriter: streamWriter{header: http.Header{}}, conn: server}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hijack-silent", nil))
+		require.Zero(t, w.code)
+		require.Zero(t, w.written)
+
+		_, ok := getRaw(context.Background(), "GET/hijack-silent")
+		require.False(t, ok)
+	})
+
+	t.Run("Streams Release Coalesced Requests", func(t *testing.T) {
+		var calls int32
+		entered := make(chan struct{}, 2)
+		both := make(chan struct{})
+
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 2 {
+				close(both)
+			}
+
+			w.Write([]byte("event"))
+			w.(http.Flusher).Flush()
+			entered <- struct{}{}
+
+			// Each stream stays open until the other has started, or gives up.
+			select {
+			case <-both:
+			case <-time.After(2 * time.Second):
+			}
+		}))
+
+		serve := func(done chan<- *streamWriter) {
+			w := &streamWriter{header: http.Header{}}
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+			done <- w
+		}
+
+		start := time.Now()
+		done := make(chan *streamWriter, 2)
+		go serve(done)
+		<-entered
+		go serve(done)
+
+		for i := 0; i < 2; i++ {
+			w := <-done
+			require.Equal(t, int64(len("event")), w.written)
+			require.Equal(t, 1, w.flushes)
+		}
+
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestMiddlewareCompression(t *testing.T) {
+	body := strings.Repeat(`{"compressible":true}`, 500)
+
+	for _, encoding := range []string{CompressionGzip, CompressionDeflate} {
+		t.Run(encoding, func(t *testing.T) {
+			target := "/compressed/" + encoding
+			h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, Compression: encoding})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(body))
+			}))
+
+			serve := func(acceptEncoding string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				r.Header.Set("Accept-Encoding", acceptEncoding)
+
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				return w
+			}
+
+			require.Equal(t, body, serve("").Body.String())
+
+			w := serve("br, " + encoding)
+			require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+			require.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, []string{"Accept-Encoding"}, w.Header().Values("Vary"))
+
+			// The compressed body is stored as is, rather than base64 encoded.
+			raw, ok := getRaw(context.Background(), "GET"+target)
+			require.True(t, ok)
+			require.Contains(t, raw, w.Body.String())
+
+			var zr io.Reader
+			var err error
+			if encoding == CompressionGzip {
+				zr, err = gzip.NewReader(w.Body)
+			} else {
+				zr, err = zlib.NewReader(w.Body)
+			}
+			require.Nil(t, err)
+			b, err := io.ReadAll(zr)
+			require.Nil(t, err)
+			require.Equal(t, body, string(b))
+
+			// The compressed representation has its own ETag.
+			etag := w.Header().Get("ETag")
+			require.NotEqual(t, response.ETag([]byte(body)), etag)
+
+			for _, acceptEncoding := range []string{"", "identity", encoding + ";q=0", "*;q=0"} {
+				w = serve(acceptEncoding)
+				require.Equal(t, "true", w.Header().Get("X-Cache-Hit"), acceptEncoding)
+				require.Empty(t, w.Header().Get("Content-Encoding"), acceptEncoding)
+				require.Equal(t, body, w.Body.String(), acceptEncoding)
+				require.Equal(t, response.ETag([]byte(body)), w.Header().Get("ETag"))
+			}
+		})
+	}
+
+	t.Run("Vary Merged", func(t *testing.T) {
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, Compression: CompressionGzip})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Vary", "accept-encoding")
+			w.Write([]byte(body))
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/compressed/vary", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, "true", w.Header().Get("X-Cache-Hit"))
+		require.Equal(t, []string{"accept-encoding"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("Uncompressed Events Replay", func(t *testing.T) {
+		h := NewMiddleware(MiddlewareOptions{Duration: time.Minute, Compression: CompressionGzip})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("handler should not be called")
+		}))
+
+		m := &metrics.NoOp{}
+		require.Nil(t, Set(m, "GET/legacy", CacheEvent{Content: "legacy", StatusCode: http.StatusOK}))
+
+		r := httptest.NewRequest(http.MethodGet, "/legacy", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		require.Equal(t, "legacy", w.Body.String())
+		require.Empty(t, w.Header().Get("Content-Encoding"))
+	})
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	// DefaultKeyBuilder builds cache keys for the middleware when no KeyFunc is configured.
+	DefaultKeyBuilder = KeyBuilder{Headers: []string{"Range"}}
+)
+
+// KeyFunc returns the key a request's response is cached under.
+type KeyFunc func(*http.Request) string
+
+// KeyBuilder builds cache keys from the parts of a request that select a distinct response.
+type KeyBuilder struct {
+	// IncludeHost prefixes keys with the requested host, without port.
+	IncludeHost bool
+
+	// SortQuery orders query parameters by name, so that their order doesn't produce separate keys.
+	SortQuery bool
+
+	// IgnoreParams are query parameters left out of the key, such as tracking parameters. A name
+	// ending in "*" matches every parameter with that prefix, e.g. "utm_*".
+	IgnoreParams []string
+
+	// Headers are request headers whose values are included in the key, e.g. Accept or Accept-Language.
+	Headers []string
+
+	// HashedHeaders are request headers included in the key as a hash of their value, so that
+	// credentials such as Authorization can scope a response without being stored in the key.
+	HashedHeaders []string
+
+	// MaxLength is the longest key produced. Longer keys are truncated and suffixed with a hash of
+	// the full key. Zero leaves keys unbounded.
+	MaxLength int
+}
+
+// Key returns the cache key for r.
+func (b KeyBuilder) Key(r *http.Request) string {
+	var key strings.Builder
+
+	if b.IncludeHost {
+		key.WriteString(requestHost(r))
+	}
+
+	key.WriteString(r.Method)
+	key.WriteString(b.uri(r))
+
+	for _, h := range b.Headers {
+		if v := strings.Join(r.Header.Values(h), ","); v != "" {
+			key.WriteString("|" + strings.ToLower(h) + "=" + v)
+		}
+	}
+
+	for _, h := range b.HashedHeaders {
+		if v := strings.Join(r.Header.Values(h), ","); v != "" {
+			key.WriteString("|" + strings.ToLower(h) + "#" + hash(v))
+		}
+	}
+
+	return b.limit(key.String())
+}
+
+// uri returns the request URI, with the query normalized as configured.
+func (b KeyBuilder) uri(r *http.Request) string {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	if !b.SortQuery && len(b.IgnoreParams) == 0 {
+		return uri
+	}
+
+	path := uri
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		path = uri[:i]
+	}
+
+	var params []string
+	for _, p := range strings.Split(r.URL.RawQuery, "&") {
+		if p != "" && !b.ignored(paramName(p)) {
+			params = append(params, p)
+		}
+	}
+
+	if len(params) == 0 {
+		return path
+	}
+
+	if b.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+	}
+
+	return path + "?" + strings.Join(params, "&")
+}
+
+// ignored reports whether the query parameter name is left out of the key.
+func (b KeyBuilder) ignored(name string) bool {
+	for _, p := range b.IgnoreParams {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+
+		if p == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limit truncates key to MaxLength, retaining uniqueness with a hash of the full key.
+func (b KeyBuilder) limit(key string) string {
+	if b.MaxLength <= 0 || len(key) <= b.MaxLength {
+		return key
+	}
+
+	h := hash(key)
+	if keep := b.MaxLength - len(h) - 1; keep > 0 {
+		return key[:keep] + "#" + h
+	}
+
+	return h
+}
+
+// paramName returns the unescaped name of a raw query parameter.
+func paramName(p string) string {
+	name := p
+	if i := strings.IndexByte(p, '='); i >= 0 {
+		name = p[:i]
+	}
+
+	if n, err := url.QueryUnescape(name); err == nil {
+		return n
+	}
+
+	return name
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = strings.Trim(r.Host, `"' ,`)
+	}
+
+	return host
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
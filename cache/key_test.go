@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyBuilder(t *testing.T) {
+	request := func(target string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Host = "example.com:8080"
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		builder KeyBuilder
+		target  string
+		headers map[string]string
+		key     string
+	}{
+		{"Default", DefaultKeyBuilder, "/a?b=2&a=1", nil, "GET/a?b=2&a=1"},
+		{"Default Range", DefaultKeyBuilder, "/a", map[string]string{"Range": "bytes=0-10"}, "GET/a|range=bytes=0-10"},
+		{"Host", KeyBuilder{IncludeHost: true}, "/a", nil, "example.comGET/a"},
+		{"Sort Query", KeyBuilder{SortQuery: true}, "/a?b=2&a=1&a=0", nil, "GET/a?a=1&a=0&b=2"},
+		{"Ignore Params", KeyBuilder{IgnoreParams: []string{"utm_*", "fbclid"}}, "/a?utm_source=x&b=2&fbclid=y&utm_medium=z&a=1", nil, "GET/a?b=2&a=1"},
+		{"Ignore All Params", KeyBuilder{IgnoreParams: []string{"utm_*"}}, "/a?utm_source=x", nil, "GET/a"},
+		{"Escaped Param Names", KeyBuilder{SortQuery: true, IgnoreParams: []string{"x y"}}, "/a?x%20y=1&b=2&a%5B%5D=1", nil, "GET/a?a%5B%5D=1&b=2"},
+		{"Headers", KeyBuilder{Headers: []string{"Accept", "Accept-Language"}}, "/a", map[string]string{"Accept": "application/json", "Accept-Language": "en"}, "GET/a|accept=application/json|accept-language=en"},
+		{"Missing Headers", KeyBuilder{Headers: []string{"Accept"}, HashedHeaders: []string{"Authorization"}}, "/a", nil, "GET/a"},
+		{"Hashed Headers", KeyBuilder{HashedHeaders: []string{"Authorization"}}, "/a", map[string]string{"Authorization": "Bearer token"}, "GET/a|authorization#" + hash("Bearer token")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.key, tc.builder.Key(request(tc.target, tc.headers)))
+		})
+	}
+
+	t.Run("Max Length", func(t *testing.T) {
+		b := KeyBuilder{MaxLength: 100}
+
+		short := b.Key(request("/short", nil))
+		require.Equal(t, "GET/short", short)
+
+		long := request("/long/"+strings.Repeat("a", 200), nil)
+		key := b.Key(long)
+		require.Len(t, key, 100)
+		require.True(t, strings.HasPrefix(key, "GET/long/aaa"))
+		require.NotEqual(t, key, b.Key(request("/long/"+strings.Repeat("a", 201), nil)))
+
+		require.Equal(t, hash(KeyBuilder{}.Key(long)), KeyBuilder{MaxLength: 10}.Key(long))
+	})
+}
+
+func TestMiddlewareKeyFunc(t *testing.T) {
+	var calls int
+	h := NewMiddleware(MiddlewareOptions{
+		Duration: time.Minute,
+		KeyFunc:  KeyBuilder{SortQuery: true, IgnoreParams: []string{"utm_*"}}.Key,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("keyed"))
+	}))
+
+	for _, target := range []string{"/keyed?a=1&b=2", "/keyed?b=2&a=1", "/keyed?utm_source=x&a=1&b=2"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, "keyed", w.Body.String())
+	}
+
+	require.Equal(t, 1, calls)
+}
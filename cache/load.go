@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+)
+
+var (
+	// DistributedLoad coordinates GetOrLoad across processes when the Cacher supports locking,
+	// such as redis.Client. Only one process will run the loader for a key, while the others wait
+	// up to LoadLockTTL for the value to appear in cache.
+	DistributedLoad = false
+
+	// LoadLockTTL is the lifetime of the lock taken during a distributed load. Processes waiting
+	// on another process' load will give up and load the value themselves after this duration.
+	LoadLockTTL = 10 * time.Second
+
+	// loadPollInterval is how often a process waiting on a distributed load checks the cache.
+	loadPollInterval = 50 * time.Millisecond
+
+	// loadTimeout bounds the cache operations of a load, which aren't canceled with the caller that
+	// started it, as other callers may be waiting on its result.
+	loadTimeout = time.Minute
+
+	loads flightGroup
+)
+
+// loadLocker is satisfied by Cachers able to take a lock across processes.
+type loadLocker interface {
+	TryLock(context.Context, string, time.Duration) (redis.Lock, error)
+}
+
+// tagged is satisfied by loaded values that should be stored with tags.
+type tagged interface {
+	cacheTags() []string
+}
+
+// expiring is satisfied by loaded values that decide how long they're stored for.
+type expiring interface {
+	cacheTTL() time.Duration
+}
+
+// encodedWith is satisfied by loaded values that choose the codec they're stored with.
+type encodedWith interface {
+	cacheCodec() Codec
+}
+
+// GetOrLoad retrieves a value from cache into container. On a miss, loader is called and its
+// result is cached for ttl before being extracted into container.
+//
+// If loader returns ErrNotFound, the absence is cached for NotFoundTTL, during which GetOrLoad
+// returns ErrCachedNotFound without calling loader.
+//
+// Concurrent misses for the same key within this process are coalesced into a single call to
+// loader, with every caller receiving its result. See DistributedLoad for coalescing across processes.
+func GetOrLoad(m metrics.Recorder, key string, container interface{}, ttl time.Duration, loader func() (interface{}, error)) error {
+	return GetOrLoadContext(withRecorder(m), key, container, ttl, loader)
+}
+
+// GetOrLoadContext retrieves a value from cache into container, loading it on a miss. See GetOrLoad.
+// The lookup is abandoned if ctx is canceled. A load is shared with concurrent callers, so its cache
+// operations carry the values of ctx but aren't canceled with it.
+func GetOrLoadContext(ctx context.Context, key string, container interface{}, ttl time.Duration, loader func() (interface{}, error)) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if c == nil {
+		return ErrCacheNil
+	}
+
+	switch err := GetContext(ctx, key, container); {
+	case err == nil, err == ErrCachedNotFound:
+		return err
+	case ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+		// The lookup was abandoned along with ctx rather than missing, so nothing is loaded.
+		return ctx.Err()
+	}
+
+	raw, err := load(ctx, key, ttl, func(func()) (interface{}, error) { return loader() }, nil)
+	if err != nil {
+		return err
+	}
+
+	return decode(raw, container)
+}
+
+// load runs loader for key at most once at a time within this process, caches the result, and
+// returns it in its serialized form. A value already in cache is returned instead of loading if
+// usable reports true for it. A nil usable accepts any cached value. The loader may call release to
+// stop other callers waiting on it, who then receive errLoadReleased.
+//
+// Other callers may be waiting on the load, so the cache operations it makes are detached from the
+// cancellation of ctx, and bounded by loadTimeout instead.
+func load(ctx context.Context, key string, ttl time.Duration, loader func(release func()) (interface{}, error), usable func(string) bool) (string, error) {
+	if usable == nil {
+		usable = func(string) bool { return true }
+	}
+
+	v, _, err := loads.do(key, func(release func()) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, loadTimeout)
+		defer cancel()
+
+		// The value may have been stored while we were waiting on a previous load.
+		if raw, ok := getRaw(ctx, key); ok && usable(raw) {
+			return raw, nil
+		}
+
+		fn := func() (interface{}, error) { return loader(release) }
+
+		if l, ok := c.(loadLocker); ok && DistributedLoad {
+			return distributedLoad(ctx, l, key, ttl, fn, usable)
+		}
+
+		return loadAndStore(ctx, key, ttl, fn)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
+
+// distributedLoad takes a lock in the shared cache before loading. If another process holds the
+// lock, we wait for it to store the value instead.
+func distributedLoad(ctx context.Context, l loadLocker, key string, ttl time.Duration, loader func() (interface{}, error), usable func(string) bool) (string, error) {
+	deadline := time.Now().Add(LoadLockTTL)
+
+	for time.Now().Before(deadline) {
+		lock, err := l.TryLock(ctx, key+":load-lock", LoadLockTTL)
+		if err == nil {
+			// Release the lock even if ctx is canceled, rather than leave others waiting out its TTL.
+			defer lock.Unlock(metrics.ContextWithRecorder(context.Background(), metrics.GetRecorder(ctx)))
+			return loadAndStore(ctx, key, ttl, loader)
+		}
+
+		if err != redis.ErrLockHeld {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(loadPollInterval):
+		}
+
+		if raw, ok := getRaw(ctx, key); ok && usable(raw) {
+			return raw, nil
+		}
+	}
+
+	return loadAndStore(ctx, key, ttl, loader)
+}
+
+// loadAndStore calls loader and caches its result.
+func loadAndStore(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error)) (string, error) {
+	v, err := loader()
+	if errors.Is(err, ErrNotFound) {
+		setRaw(ctx, key, tombstone, NotFoundTTL, nil)
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := encode(codecFor(v), v)
+	if err != nil {
+		return "", err
+	}
+
+	if e, ok := v.(expiring); ok && e.cacheTTL() > 0 {
+		ttl = e.cacheTTL()
+	}
+
+	if ttl < 0 {
+		ttl = time.Duration(c.ForeverTTL())
+	}
+
+	var tags []string
+	if t, ok := v.(tagged); ok {
+		tags = t.cacheTags()
+	}
+
+	setRaw(ctx, key, raw, ttl, tags)
+	return raw, nil
+}
+
+func getRaw(ctx context.Context, key string) (string, bool) {
+	raw, err := WithContext(c).Get(ctx, key)
+	if err != nil {
+		return "", false
+	}
+
+	s, ok := raw.(string)
+	return s, ok
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("Coalesces Concurrent Loads", func(t *testing.T) {
+		var calls int32
+		loader := func() (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return map[string]int{"answer": 42}, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 25; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var actual map[string]int
+				require.Nil(t, GetOrLoad(m, "coalesce", &actual, time.Minute, loader))
+				require.Equal(t, map[string]int{"answer": 42}, actual)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		var cached map[string]int
+		require.Nil(t, Get(m, "coalesce", &cached))
+		require.Equal(t, map[string]int{"answer": 42}, cached)
+	})
+
+	t.Run("Loader Errors Are Not Cached", func(t *testing.T) {
+		expected := errors.New("boom")
+
+		var actual string
+		err := GetOrLoad(m, t.Name(), &actual, time.Minute, func() (interface{}, error) { return nil, expected })
+		require.Equal(t, expected, err)
+
+		err = GetOrLoad(m, t.Name(), &actual, time.Minute, func() (interface{}, error) { return "ok", nil })
+		require.Nil(t, err)
+		require.Equal(t, "ok", actual)
+	})
+
+	t.Run("Leader Cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started, proceed := make(chan struct{}), make(chan struct{})
+		loader := func() (interface{}, error) {
+			close(started)
+			<-proceed
+			return "loaded", nil
+		}
+
+		leader := make(chan error, 1)
+		go func() {
+			var actual string
+			leader <- GetOrLoadContext(ctx, t.Name(), &actual, time.Minute, loader)
+		}()
+		<-started
+
+		waiter := make(chan error, 1)
+		go func() {
+			var actual string
+			waiter <- GetOrLoad(m, t.Name(), &actual, time.Minute, loader)
+		}()
+
+		// The leader goes away while the waiter depends on its load.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		close(proceed)
+
+		require.Nil(t, <-leader)
+		require.Nil(t, <-waiter)
+
+		var cached string
+		require.Nil(t, Get(m, t.Name(), &cached))
+		require.Equal(t, "loaded", cached)
+	})
+
+	t.Run("Distributed", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rdb := redis.New(mr.Addr(), time.Second, "load_test")
+
+		Initialize(rdb, time.Minute)
+		DistributedLoad = true
+		defer func() {
+			DistributedLoad = false
+			Initialize(NewMemoryCache(5*time.Minute), 0)
+		}()
+
+		// Another process is mid-load.
+		acquired, err := rdb.SetNX(m, "distributed:load-lock", "1", LoadLockTTL)
+		require.Nil(t, err)
+		require.True(t, acquired)
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			Set(m, "distributed", "from elsewhere")
+		}()
+
+		var actual string
+		err = GetOrLoad(m, "distributed", &actual, time.Minute, func() (interface{}, error) {
+			return "from here", nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, "from elsewhere", actual)
+
+		// Our own load takes the lock, and releases it once done.
+		err = GetOrLoad(m, "distributed-own", &actual, time.Minute, func() (interface{}, error) {
+			require.True(t, mr.Exists("distributed-own:load-lock"))
+			return "from here", nil
+		})
+		require.Nil(t, err)
+		require.Equal(t, "from here", actual)
+		require.False(t, mr.Exists("distributed-own:load-lock"))
+	})
+}
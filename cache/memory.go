@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/btm6084/utilities/metrics"
@@ -11,11 +13,24 @@ import (
 type MemoryCache struct {
 	cache      *cache.Cache
 	defaultTTL time.Duration
+
+	// tags maps each tag to the keys it holds, and keyTags each key to its tags.
+	mu      sync.Mutex
+	tags    map[string]map[string]struct{}
+	keyTags map[string][]string
 }
 
 // NewMemoryCache returns an in-memory Cacher
 func NewMemoryCache(defaultTTL time.Duration) Cacher {
-	return &MemoryCache{defaultTTL: defaultTTL, cache: cache.New(defaultTTL, 2*defaultTTL)}
+	c := &MemoryCache{
+		defaultTTL: defaultTTL,
+		cache:      cache.New(defaultTTL, 2*defaultTTL),
+		tags:       map[string]map[string]struct{}{},
+		keyTags:    map[string][]string{},
+	}
+	c.cache.OnEvicted(func(key string, _ interface{}) { c.untag(key) })
+
+	return c
 }
 
 // ForeverTTL returns the go-cache value that represents the no-expire TTL value.
@@ -48,7 +63,7 @@ func (c *MemoryCache) SetWithDuration(m metrics.Recorder, key string, value inte
 		return ErrCacheNil
 	}
 
-	c.cache.Set(key, value, d)
+	c.set(key, value, d, nil)
 	return nil
 }
 
@@ -61,3 +76,143 @@ func (c *MemoryCache) Delete(m metrics.Recorder, key string) error {
 	c.cache.Delete(key)
 	return nil
 }
+
+// GetMany returns the values at keys. Keys not in cache are reported as ErrNotFound.
+func (c *MemoryCache) GetMany(m metrics.Recorder, keys []string) (map[string]interface{}, map[string]error) {
+	vals := map[string]interface{}{}
+	errs := map[string]error{}
+	for _, key := range keys {
+		val, err := c.Get(m, key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+
+		vals[key] = val
+	}
+
+	return vals, errs
+}
+
+// SetMany sets each of values in cache at its key.
+func (c *MemoryCache) SetMany(m metrics.Recorder, values map[string]interface{}, d time.Duration) error {
+	for key, value := range values {
+		if err := c.SetWithDuration(m, key, value, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteMany removes keys from cache.
+func (c *MemoryCache) DeleteMany(m metrics.Recorder, keys []string) error {
+	for _, key := range keys {
+		if err := c.Delete(m, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetWithTags sets a value in cache, associating key with each tag so that it's removed by InvalidateTag.
+// Any tags key was previously set with are replaced.
+func (c *MemoryCache) SetWithTags(m metrics.Recorder, key string, value interface{}, d time.Duration, tags ...string) error {
+	if c.cache == nil {
+		return ErrCacheNil
+	}
+
+	c.set(key, value, d, tags)
+	return nil
+}
+
+// set stores value at key, replacing the tags key was previously set with. Overwriting a key doesn't
+// evict it, so its old tags are removed here rather than by untag.
+func (c *MemoryCache) set(key string, value interface{}, d time.Duration, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Set(key, value, d)
+	c.removeTags(key)
+
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+
+		if _, ok := c.tags[tag][key]; !ok {
+			c.tags[tag][key] = struct{}{}
+			c.keyTags[key] = append(c.keyTags[key], tag)
+		}
+	}
+}
+
+// InvalidateTag removes every key associated with tag.
+func (c *MemoryCache) InvalidateTag(m metrics.Recorder, tag string) error {
+	if c.cache == nil {
+		return ErrCacheNil
+	}
+
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.tags[tag]))
+	for key := range c.tags[tag] {
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+
+	for _, key := range keys {
+		c.cache.Delete(key)
+	}
+
+	return nil
+}
+
+// DeletePrefix removes every key beginning with prefix.
+func (c *MemoryCache) DeletePrefix(m metrics.Recorder, prefix string) error {
+	if c.cache == nil {
+		return ErrCacheNil
+	}
+
+	for key := range c.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.cache.Delete(key)
+		}
+	}
+
+	return nil
+}
+
+// flush removes every key.
+func (c *MemoryCache) flush() {
+	if c.cache == nil {
+		return
+	}
+
+	c.cache.Flush()
+
+	c.mu.Lock()
+	c.tags = map[string]map[string]struct{}{}
+	c.keyTags = map[string][]string{}
+	c.mu.Unlock()
+}
+
+// untag removes key from the tag index once it leaves the cache.
+func (c *MemoryCache) untag(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeTags(key)
+}
+
+// removeTags removes key from the tag index. The caller must hold the lock.
+func (c *MemoryCache) removeTags(key string) {
+	for _, tag := range c.keyTags[key] {
+		delete(c.tags[tag], key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+
+	delete(c.keyTags, key)
+}
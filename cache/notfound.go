@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+// notFoundCodec names the header of a tombstone, which records that a value doesn't exist.
+const notFoundCodec = "notfound"
+
+var (
+	// NotFoundTTL is how long the absence of a value is cached for, by SetNotFound and loaders
+	// that find nothing.
+	NotFoundTTL = time.Minute
+
+	// tombstone is stored in place of a value that doesn't exist.
+	tombstone = frame(notFoundCodec, nil)
+)
+
+// SetNotFound records in cache that the value at key doesn't exist, for NotFoundTTL. Until it
+// expires, or key is set, Get returns ErrCachedNotFound for key.
+func SetNotFound(m metrics.Recorder, key string) error {
+	return SetNotFoundContext(withRecorder(m), key)
+}
+
+// SetNotFoundContext records in cache that the value at key doesn't exist. See SetNotFound.
+func SetNotFoundContext(ctx context.Context, key string) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if c == nil {
+		return ErrCacheNil
+	}
+
+	return WithContext(c).SetWithDuration(ctx, key, tombstone, NotFoundTTL)
+}
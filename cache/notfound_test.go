@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotFound(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("Tombstone", func(t *testing.T) {
+		require.Nil(t, SetNotFound(m, t.Name()))
+
+		var actual string
+		require.Equal(t, ErrCachedNotFound, Get(m, t.Name(), &actual))
+
+		_, err := GetT[string](m, t.Name())
+		require.Equal(t, ErrCachedNotFound, err)
+
+		_, errs := GetMany[string](m, t.Name())
+		require.Equal(t, map[string]error{t.Name(): ErrCachedNotFound}, errs)
+
+		require.Nil(t, Set(m, t.Name(), "found"))
+		require.Nil(t, Get(m, t.Name(), &actual))
+		require.Equal(t, "found", actual)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		defer func(ttl time.Duration) { NotFoundTTL = ttl }(NotFoundTTL)
+		NotFoundTTL = 50 * time.Millisecond
+
+		require.Nil(t, SetNotFound(m, t.Name()))
+
+		var actual string
+		require.Equal(t, ErrCachedNotFound, Get(m, t.Name(), &actual))
+
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, ErrNotFound, Get(m, t.Name(), &actual))
+	})
+
+	t.Run("GetOrLoad", func(t *testing.T) {
+		calls := 0
+		loader := func() (interface{}, error) {
+			calls++
+			return nil, fmt.Errorf("no such record: %w", ErrNotFound)
+		}
+
+		var actual string
+		err := GetOrLoad(m, t.Name(), &actual, time.Minute, loader)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		err = GetOrLoad(m, t.Name(), &actual, time.Minute, loader)
+		require.Equal(t, ErrCachedNotFound, err)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("Other Errors Are Not Cached", func(t *testing.T) {
+		calls := 0
+		loader := func() (interface{}, error) {
+			calls++
+			return nil, fmt.Errorf("database unavailable")
+		}
+
+		var actual string
+		require.NotNil(t, GetOrLoad(m, t.Name(), &actual, time.Minute, loader))
+		require.NotNil(t, GetOrLoad(m, t.Name(), &actual, time.Minute, loader))
+		require.Equal(t, 2, calls)
+	})
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/health"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisHealthCheck(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+
+	t.Run("Circuit Breaker", func(t *testing.T) {
+		rdb := redis.NewWithOptions(redis.ClientOptions{
+			Addr:           mr.Addr(),
+			RequestTimeout: time.Second,
+			MaxRetries:     -1,
+			Breaker:        &redis.BreakerOptions{Failures: 1, Cooldown: time.Minute},
+		})
+		defer rdb.RDB.Close()
+
+		hc := HealthCheck(rdb)
+		require.Equal(t, health.OK, hc.Status)
+		require.Equal(t, "closed", hc.Data["circuitBreaker"])
+
+		mr.Close()
+		_, err := rdb.Get(m, "key")
+		require.NotNil(t, err)
+		require.Equal(t, redis.BreakerOpen, rdb.Breaker().State())
+
+		// The cache is bypassed while the breaker is open, rather than failing requests.
+		hc = HealthCheck(rdb)
+		require.Equal(t, health.WARNING, hc.Status)
+		require.Equal(t, "open", hc.Data["circuitBreaker"])
+		require.Nil(t, mr.Restart())
+	})
+
+	t.Run("No Breaker", func(t *testing.T) {
+		plain := redis.New(mr.Addr(), time.Second, "no_breaker")
+		defer plain.RDB.Close()
+
+		hc := HealthCheck(plain)
+		require.Equal(t, health.OK, hc.Status)
+		_, ok := hc.Data["circuitBreaker"]
+		require.False(t, ok)
+	})
+}
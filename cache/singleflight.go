@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// errLoadPanicked is reported to callers waiting on a load whose function panicked.
+	errLoadPanicked = errors.New("cache load panicked")
+
+	// errLoadReleased is reported to callers waiting on a load that released them before completing.
+	errLoadReleased = errors.New("cache load released its waiters")
+)
+
+// flight is an in-progress or completed call to flightGroup.do
+type flight struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	val  interface{}
+	err  error
+}
+
+// flightGroup coalesces concurrent calls for the same key into a single execution.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do executes fn, making sure only one execution is in-flight for a given key at a time. Callers
+// arriving while an execution is in-flight wait for it to complete and receive the same results.
+// The returned bool reports whether the results were shared with another caller.
+//
+// fn may call release to hand the callers waiting on it errLoadReleased without waiting for it to
+// complete, e.g. when its results won't be worth sharing. Callers arriving after release start a new
+// execution.
+func (g *flightGroup) do(key string, fn func(release func()) (interface{}, error)) (interface{}, bool, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.val, true, f.err
+	}
+
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	// Release waiters even if fn panics. They receive errLoadPanicked, while the panic continues
+	// up the stack of the caller that executed fn.
+	var val interface{}
+	err := errLoadPanicked
+	defer func() { g.complete(key, f, val, err) }()
+
+	val, err = fn(func() { g.complete(key, f, nil, errLoadReleased) })
+	return val, false, err
+}
+
+// complete hands the callers waiting on f its results, and removes it from the group. Only the
+// first call for a flight has any effect.
+func (g *flightGroup) complete(key string, f *flight, val interface{}, err error) {
+	f.once.Do(func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+
+		f.val, f.err = val, err
+		f.wg.Done()
+	})
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+// tagsKey is the key under which the tag collector is stored in a request context.
+const tagsKey contextKey = "tags"
+
+var (
+	// ErrTagsUnsupported is returned when the configured Cacher can not group keys by tag or prefix.
+	ErrTagsUnsupported = errors.New("cache does not support tags")
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ TagCacher = (*MemoryCache)(nil)
+	_ TagCacher = (*TieredCache)(nil)
+)
+
+type contextKey string
+
+// TagCacher is a Cacher able to remove related keys together, either by a tag attached when the
+// key was stored, or by a common prefix.
+type TagCacher interface {
+	Cacher
+	SetWithTags(metrics.Recorder, string, interface{}, time.Duration, ...string) error
+	InvalidateTag(metrics.Recorder, string) error
+	DeletePrefix(metrics.Recorder, string) error
+}
+
+// SetWithTags sets a value in cache, associating it with each tag so that it's removed by InvalidateTag.
+// Value MUST be serializeable by the configured Codec.
+func SetWithTags(m metrics.Recorder, key string, value interface{}, d time.Duration, tags ...string) error {
+	if d < 0 {
+		d = time.Duration(c.ForeverTTL())
+	}
+
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if c == nil {
+		return ErrCacheNil
+	}
+
+	if _, ok := c.(TagCacher); !ok && len(tags) > 0 {
+		return ErrTagsUnsupported
+	}
+
+	return setTagged(withRecorder(m), key, value, d, tags)
+}
+
+// InvalidateTag removes every value stored with tag.
+func InvalidateTag(m metrics.Recorder, tag string) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	tc, ok := c.(TagCacher)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	return tc.InvalidateTag(m, tag)
+}
+
+// DeletePrefix removes every value whose key begins with prefix.
+func DeletePrefix(m metrics.Recorder, prefix string) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	tc, ok := c.(TagCacher)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	return tc.DeletePrefix(m, prefix)
+}
+
+// setTagged encodes and stores a value, with tags when there are any.
+func setTagged(ctx context.Context, key string, value interface{}, d time.Duration, tags []string) error {
+	raw, err := encode(codecFor(value), value)
+	if err != nil {
+		return err
+	}
+
+	return setRaw(ctx, key, raw, d, tags)
+}
+
+// setRaw stores an encoded value, with tags when there are any. Tags are dropped if the Cacher
+// doesn't support them.
+func setRaw(ctx context.Context, key, raw string, d time.Duration, tags []string) error {
+	if tc, ok := c.(TagCacher); ok && len(tags) > 0 {
+		if err := tc.SetWithTags(metrics.GetRecorder(ctx), key, raw, d, tags...); err != ErrTagsUnsupported {
+			return err
+		}
+	}
+
+	return WithContext(c).SetWithDuration(ctx, key, raw, d)
+}
+
+// tagCollector gathers the tags added while rendering a response.
+type tagCollector struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+func (t *tagCollector) add(tags ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tag := range tags {
+		if !contains(t.tags, tag) {
+			t.tags = append(t.tags, tag)
+		}
+	}
+}
+
+func (t *tagCollector) list() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.tags...)
+}
+
+// AddTags attaches tags to the response being rendered under ctx, such that the response is removed
+// from cache by InvalidateTag. It has no effect outside of the cache middleware.
+func AddTags(ctx context.Context, tags ...string) {
+	if t, ok := ctx.Value(tagsKey).(*tagCollector); ok {
+		t.add(tags...)
+	}
+}
+
+func contextWithTagCollector(ctx context.Context) (context.Context, *tagCollector) {
+	t := &tagCollector{}
+	return context.WithValue(ctx, tagsKey, t), t
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
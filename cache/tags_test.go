@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagCacher(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	for name, cacher := range testCachers(t) {
+		tc := cacher.(TagCacher)
+
+		t.Run(name+" Invalidate Tag", func(t *testing.T) {
+			require.Nil(t, tc.SetWithTags(m, "tag:1", "one", time.Minute, "a"))
+			require.Nil(t, tc.SetWithTags(m, "tag:2", "two", time.Minute, "a", "b"))
+			require.Nil(t, tc.SetWithTags(m, "tag:3", "three", time.Minute, "b"))
+
+			require.Nil(t, tc.InvalidateTag(m, "a"))
+
+			for _, key := range []string{"tag:1", "tag:2"} {
+				_, err := tc.Get(m, key)
+				require.NotNil(t, err, key)
+			}
+
+			val, err := tc.Get(m, "tag:3")
+			require.Nil(t, err)
+			require.Equal(t, "three", val)
+
+			// Invalidating an unknown tag is not an error.
+			require.Nil(t, tc.InvalidateTag(m, "unknown"))
+		})
+
+		t.Run(name+" Delete Prefix", func(t *testing.T) {
+			require.Nil(t, tc.SetWithDuration(m, "prefix:[1]", "one", time.Minute))
+			require.Nil(t, tc.SetWithDuration(m, "prefix:2", "two", time.Minute))
+			require.Nil(t, tc.SetWithDuration(m, "prefixed", "kept", time.Minute))
+
+			require.Nil(t, tc.DeletePrefix(m, "prefix:"))
+
+			for _, key := range []string{"prefix:[1]", "prefix:2"} {
+				_, err := tc.Get(m, key)
+				require.NotNil(t, err, key)
+			}
+
+			val, err := tc.Get(m, "prefixed")
+			require.Nil(t, err)
+			require.Equal(t, "kept", val)
+		})
+	}
+}
+
+func TestMemoryCacheRetag(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("Overwriting Untagged Drops Old Tags", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute).(*MemoryCache)
+		require.Nil(t, mc.SetWithTags(m, "key", "tagged", time.Minute, "old"))
+		require.Nil(t, mc.Set(m, "key", "untagged"))
+
+		require.Nil(t, mc.InvalidateTag(m, "old"))
+		val, err := mc.Get(m, "key")
+		require.Nil(t, err)
+		require.Equal(t, "untagged", val)
+	})
+
+	t.Run("Overwriting With Tags Replaces Old Tags", func(t *testing.T) {
+		mc := NewMemoryCache(time.Minute).(*MemoryCache)
+		require.Nil(t, mc.SetWithTags(m, "key", "first", time.Minute, "old"))
+		require.Nil(t, mc.SetWithTags(m, "key", "second", time.Minute, "new"))
+
+		require.Nil(t, mc.InvalidateTag(m, "old"))
+		val, err := mc.Get(m, "key")
+		require.Nil(t, err)
+		require.Equal(t, "second", val)
+
+		require.Nil(t, mc.InvalidateTag(m, "new"))
+		_, err = mc.Get(m, "key")
+		require.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestRedisTagTTL(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	r := redis.New(mr.Addr(), time.Second, "tags_test")
+
+	require.Nil(t, r.SetWithTags(m, "short", "v", time.Minute, "ttl"))
+	require.Nil(t, r.SetWithTags(m, "long", "v", time.Hour, "ttl"))
+	require.Nil(t, r.SetWithTags(m, "shorter", "v", time.Second, "ttl"))
+
+	// The tag set lives as long as its longest lived key.
+	require.Equal(t, time.Hour, mr.TTL(redis.TagPrefix+"ttl"))
+}
+
+func TestMiddlewareTags(t *testing.T) {
+	var calls int32
+	h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		AddTags(r.Context(), "article:1")
+		w.Write([]byte("article"))
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/article/1", nil))
+		return w
+	}
+
+	require.Equal(t, "false", serve().Header().Get("X-Cache-Hit"))
+	require.Equal(t, "true", serve().Header().Get("X-Cache-Hit"))
+
+	require.Nil(t, InvalidateTag(&metrics.NoOp{}, "article:1"))
+
+	require.Equal(t, "false", serve().Header().Get("X-Cache-Hit"))
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Outside of the middleware, tags are ignored.
+	AddTags(context.Background(), "ignored")
+}
@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/google/uuid"
+)
+
+var (
+	// TieredInvalidationChannel is the pub/sub channel used by TieredCache instances to evict
+	// each other's in-memory entries.
+	TieredInvalidationChannel = "cache:tiered:invalidate"
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Cacher = (*TieredCache)(nil)
+)
+
+// TieredCache is a Cacher that reads through an in-process MemoryCache (L1) before a shared
+// redis.Cache (L2), and writes to both.
+//
+// L1 entries live for at most the L1 TTL, which should be kept short. If L2 also implements
+// redis.PubSub, writes and deletes are broadcast so that every instance evicts the key from L1.
+// Broadcasts that fail, such as while the circuit breaker of a redis.Client is open, are logged
+// and not retried, so other instances may serve the old value from L1 until it expires.
+type TieredCache struct {
+	l1    *MemoryCache
+	l2    redis.Cache
+	l1TTL time.Duration
+
+	// id identifies this instance, so that it can ignore its own invalidations.
+	id string
+}
+
+// invalidation is the message broadcast to evict L1 entries on other instances.
+type invalidation struct {
+	Origin string `json:"origin"`
+	Key    string `json:"key,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+
+	// Tag is set when a tag was invalidated. Values read into L1 from L2 don't carry their tags, so
+	// every instance flushes L1 entirely.
+	Tag string `json:"tag,omitempty"`
+}
+
+// NewTieredCache returns a TieredCache in front of l2, holding values in memory for up to l1TTL.
+// Invalidations from other instances are received until ctx is canceled.
+func NewTieredCache(ctx context.Context, l2 redis.Cache, l1TTL time.Duration) *TieredCache {
+	t := &TieredCache{
+		l1:    NewMemoryCache(l1TTL).(*MemoryCache),
+		l2:    l2,
+		l1TTL: l1TTL,
+		id:    uuid.NewString(),
+	}
+
+	if ps, ok := l2.(redis.PubSub); ok {
+		t.listen(ctx, ps)
+	}
+
+	return t
+}
+
+// ForeverTTL returns the L2 value that represents the no-expire TTL value.
+func (t *TieredCache) ForeverTTL() int {
+	return t.l2.ForeverTTL()
+}
+
+// Get a value from L1, falling back to L2. Values found in L2 are copied into L1.
+func (t *TieredCache) Get(m metrics.Recorder, key string) (interface{}, error) {
+	if val, err := t.l1.Get(m, key); err == nil {
+		return val, nil
+	}
+
+	val, err := t.l2.Get(m, key)
+	if err != nil {
+		if err == redis.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	t.l1.SetWithDuration(m, key, val, t.l1TTL)
+	return val, nil
+}
+
+// Set a value in both tiers, using the L2 default TTL.
+func (t *TieredCache) Set(m metrics.Recorder, key string, value interface{}) error {
+	if err := t.l2.Set(m, key, value); err != nil {
+		return err
+	}
+
+	t.l1.SetWithDuration(m, key, value, t.l1TTL)
+	t.invalidate(m, key)
+	return nil
+}
+
+// SetWithDuration sets a value in both tiers. L1 holds the value for the shorter of d and the L1 TTL.
+func (t *TieredCache) SetWithDuration(m metrics.Recorder, key string, value interface{}, d time.Duration) error {
+	if err := t.l2.SetWithDuration(m, key, value, d); err != nil {
+		return err
+	}
+
+	t.l1.SetWithDuration(m, key, value, t.localTTL(d))
+	t.invalidate(m, key)
+	return nil
+}
+
+// Delete removes a key from both tiers, and from L1 on all other instances.
+func (t *TieredCache) Delete(m metrics.Recorder, key string) error {
+	t.l1.Delete(m, key)
+
+	if err := t.l2.Delete(m, key); err != nil {
+		return err
+	}
+
+	t.invalidate(m, key)
+	return nil
+}
+
+// SetWithTags sets a value in both tiers, associating it with each tag. L2 must implement redis.Tagger.
+func (t *TieredCache) SetWithTags(m metrics.Recorder, key string, value interface{}, d time.Duration, tags ...string) error {
+	l2, ok := t.l2.(redis.Tagger)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	if err := l2.SetWithTags(m, key, value, d, tags...); err != nil {
+		return err
+	}
+
+	t.l1.SetWithDuration(m, key, value, t.localTTL(d))
+	t.invalidate(m, key)
+	return nil
+}
+
+// InvalidateTag removes every key associated with tag from L2, and flushes L1 on all instances.
+// L2 must implement redis.Tagger.
+func (t *TieredCache) InvalidateTag(m metrics.Recorder, tag string) error {
+	l2, ok := t.l2.(redis.Tagger)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	if err := l2.InvalidateTag(m, tag); err != nil {
+		return err
+	}
+
+	t.l1.flush()
+	t.broadcast(m, invalidation{Tag: tag})
+	return nil
+}
+
+// DeletePrefix removes every key beginning with prefix from both tiers, and from L1 on all other
+// instances. L2 must implement redis.Tagger.
+func (t *TieredCache) DeletePrefix(m metrics.Recorder, prefix string) error {
+	l2, ok := t.l2.(redis.Tagger)
+	if !ok {
+		return ErrTagsUnsupported
+	}
+
+	t.l1.DeletePrefix(m, prefix)
+
+	if err := l2.DeletePrefix(m, prefix); err != nil {
+		return err
+	}
+
+	t.broadcast(m, invalidation{Prefix: prefix})
+	return nil
+}
+
+// localTTL returns the L1 lifetime for a value stored in L2 for d.
+func (t *TieredCache) localTTL(d time.Duration) time.Duration {
+	if d <= 0 || d > t.l1TTL {
+		return t.l1TTL
+	}
+
+	return d
+}
+
+// invalidate tells other instances to evict key from L1.
+func (t *TieredCache) invalidate(m metrics.Recorder, key string) {
+	t.broadcast(m, invalidation{Key: key})
+}
+
+// broadcast sends inv to all other instances.
+func (t *TieredCache) broadcast(m metrics.Recorder, inv invalidation) {
+	ps, ok := t.l2.(redis.PubSub)
+	if !ok {
+		return
+	}
+
+	inv.Origin = t.id
+	msg, err := json.Marshal(inv)
+	if err != nil {
+		return
+	}
+
+	if err := ps.Publish(m, TieredInvalidationChannel, string(msg)); err != nil {
+		log.Printf("cache: unable to broadcast tiered cache invalidation: %s\n", err)
+	}
+}
+
+// listen evicts keys from L1 as other instances invalidate them.
+func (t *TieredCache) listen(ctx context.Context, ps redis.PubSub) {
+	msgs, err := ps.Subscribe(ctx, TieredInvalidationChannel)
+	if err != nil {
+		log.Printf("cache: tiered cache will not receive invalidations: %s\n", err)
+		return
+	}
+
+	go func() {
+		m := &metrics.NoOp{}
+		for msg := range msgs {
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg), &inv); err != nil || inv.Origin == t.id {
+				continue
+			}
+
+			switch {
+			case inv.Tag != "":
+				t.l1.flush()
+			case inv.Prefix != "":
+				t.l1.DeletePrefix(m, inv.Prefix)
+			default:
+				t.l1.Delete(m, inv.Key)
+			}
+		}
+	}()
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredCache(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewTieredCache(ctx, redis.New(mr.Addr(), time.Second, "tiered_a"), time.Minute)
+	b := NewTieredCache(ctx, redis.New(mr.Addr(), time.Second, "tiered_b"), time.Minute)
+
+	t.Run("Reads Through To L2", func(t *testing.T) {
+		require.Nil(t, a.Set(m, "read-through", "value"))
+
+		val, err := b.Get(m, "read-through")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		// b now serves the value from L1, even once it is gone from L2.
+		mr.Del("read-through")
+		val, err = b.Get(m, "read-through")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := a.Get(m, "missing")
+		require.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Writes Evict Other Instances", func(t *testing.T) {
+		require.Nil(t, a.Set(m, "evict", "first"))
+
+		val, err := b.Get(m, "evict")
+		require.Nil(t, err)
+		require.Equal(t, "first", val)
+
+		require.Nil(t, a.Set(m, "evict", "second"))
+		require.Eventually(t, func() bool {
+			val, err := b.Get(m, "evict")
+			return err == nil && val == "second"
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Deletes Evict Other Instances", func(t *testing.T) {
+		require.Nil(t, a.Set(m, "delete", "value"))
+
+		_, err := b.Get(m, "delete")
+		require.Nil(t, err)
+
+		require.Nil(t, a.Delete(m, "delete"))
+		require.Eventually(t, func() bool {
+			_, err := b.Get(m, "delete")
+			return err == ErrNotFound
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("L1 TTL", func(t *testing.T) {
+		c := NewTieredCache(ctx, redis.New(mr.Addr(), time.Second, "tiered_c"), 50*time.Millisecond)
+
+		require.Nil(t, c.SetWithDuration(m, "l1-ttl", "value", time.Minute))
+		mr.Del("l1-ttl")
+
+		val, err := c.Get(m, "l1-ttl")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+
+		time.Sleep(100 * time.Millisecond)
+		_, err = c.Get(m, "l1-ttl")
+		require.Equal(t, ErrNotFound, err)
+	})
+}
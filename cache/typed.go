@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+// Typed provides type-safe access to a Cacher. Values are serialized with the provided Codec
+// and returned as a T directly, avoiding the reflection performed by Get. Values are decoded with
+// the codec that stored them, so changing the Codec does not invalidate existing entries.
+type Typed[T any] struct {
+	Cacher     Cacher
+	Codec      Codec
+	DefaultTTL time.Duration
+}
+
+// NewTyped returns a Typed cache of T stored in the given Cacher. A nil codec defaults to JSONCodec.
+// Custom codecs should be registered with RegisterCodec so that their values can be decoded.
+func NewTyped[T any](c Cacher, codec Codec, defaultTTL time.Duration) *Typed[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return &Typed[T]{Cacher: c, Codec: codec, DefaultTTL: defaultTTL}
+}
+
+// Get a value from cache.
+func (t *Typed[T]) Get(m metrics.Recorder, key string) (T, error) {
+	var out T
+
+	if !Enabled {
+		return out, ErrCacheDisabled
+	}
+
+	if t.Cacher == nil {
+		return out, ErrCacheNil
+	}
+
+	raw, err := t.Cacher.Get(m, key)
+	if err != nil {
+		return out, err
+	}
+
+	b, ok := rawBytes(raw)
+	if !ok {
+		return out, ErrDeserialize
+	}
+
+	name, payload, framed, err := unframe(string(b))
+	if err != nil {
+		return out, err
+	}
+
+	// Values stored without a header predate codecs, and are always JSON.
+	codec := Codec(JSONCodec{})
+	if framed {
+		codec, err = lookupCodec(name)
+		if err != nil {
+			return out, err
+		}
+	}
+
+	if err := codec.Unmarshal([]byte(payload), &out); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
+
+// Set a value in cache with the default TTL.
+func (t *Typed[T]) Set(m metrics.Recorder, key string, value T) error {
+	return t.SetWithDuration(m, key, value, t.DefaultTTL)
+}
+
+// SetWithDuration sets a value in cache. A negative duration stores the value without expiration.
+func (t *Typed[T]) SetWithDuration(m metrics.Recorder, key string, value T, d time.Duration) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if t.Cacher == nil {
+		return ErrCacheNil
+	}
+
+	if d < 0 {
+		d = time.Duration(t.Cacher.ForeverTTL())
+	}
+
+	codec := t.codec()
+
+	b, err := codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return t.Cacher.SetWithDuration(m, key, frame(codec.Name(), b), d)
+}
+
+// Delete a value from cache.
+func (t *Typed[T]) Delete(m metrics.Recorder, key string) error {
+	if !Enabled {
+		return ErrCacheDisabled
+	}
+
+	if t.Cacher == nil {
+		return ErrCacheNil
+	}
+
+	return t.Cacher.Delete(m, key)
+}
+
+func (t *Typed[T]) codec() Codec {
+	if t.Codec == nil {
+		return JSONCodec{}
+	}
+
+	return t.Codec
+}
+
+// GetT retrieves a value of type T from the package level cache. Values must have been stored by SetT.
+func GetT[T any](m metrics.Recorder, key string) (T, error) {
+	return NewTyped[T](c, defaultCodec, dur).Get(m, key)
+}
+
+// SetT stores a value of type T in the package level cache with the default duration and codec.
+func SetT[T any](m metrics.Recorder, key string, value T) error {
+	return NewTyped[T](c, defaultCodec, dur).Set(m, key, value)
+}
+
+// SetTWithDuration stores a value of type T in the package level cache.
+func SetTWithDuration[T any](m metrics.Recorder, key string, value T, d time.Duration) error {
+	return NewTyped[T](c, defaultCodec, dur).SetWithDuration(m, key, value, d)
+}
+
+func rawBytes(raw interface{}) ([]byte, bool) {
+	switch v := raw.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func testCachers(t *testing.T) map[string]Cacher {
+	mr := miniredis.RunT(t)
+
+	return map[string]Cacher{
+		"memory": NewMemoryCache(time.Minute),
+		"redis":  redis.New(mr.Addr(), time.Second, "typed_test"),
+	}
+}
+
+func TestTyped(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	type Substruct struct {
+		Things map[string]string `json:"things"`
+	}
+	type TestStruct struct {
+		Bool   bool        `json:"bool"`
+		Int    int         `json:"int"`
+		Slice  []byte      `json:"slice"`
+		String string      `json:"string"`
+		Stuff  []Substruct `json:"stuff"`
+	}
+
+	data := TestStruct{
+		Bool:   true,
+		Int:    12786,
+		Slice:  []byte{'\x00', '\x01', '\x02', '\xff'},
+		String: `Such a nice string`,
+		Stuff: []Substruct{
+			{Things: map[string]string{"Oh": "Didn't See you there"}},
+		},
+	}
+
+	for name, cacher := range testCachers(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Bytes", func(t *testing.T) {
+				tc := NewTyped[[]byte](cacher, nil, time.Minute)
+				expected := []byte{'\x00', '\x01', '\x02', '\x03', '\x04', '\x05', '\x06', '\x07', '\x08', '\x09', '\x10', '\xff'}
+
+				require.Nil(t, tc.Set(m, t.Name(), expected))
+
+				actual, err := tc.Get(m, t.Name())
+				require.Nil(t, err)
+				require.Equal(t, expected, actual)
+			})
+
+			t.Run("Struct", func(t *testing.T) {
+				tc := NewTyped[TestStruct](cacher, nil, time.Minute)
+				require.Nil(t, tc.Set(m, t.Name(), data))
+
+				actual, err := tc.Get(m, t.Name())
+				require.Nil(t, err)
+				require.Equal(t, data, actual)
+			})
+
+			t.Run("Pointer", func(t *testing.T) {
+				tc := NewTyped[*TestStruct](cacher, nil, time.Minute)
+				require.Nil(t, tc.Set(m, t.Name(), &data))
+
+				actual, err := tc.Get(m, t.Name())
+				require.Nil(t, err)
+				require.NotNil(t, actual)
+				require.Equal(t, data, *actual)
+			})
+
+			t.Run("Nil Pointer", func(t *testing.T) {
+				tc := NewTyped[*TestStruct](cacher, nil, time.Minute)
+				require.Nil(t, tc.Set(m, t.Name(), nil))
+
+				actual, err := tc.Get(m, t.Name())
+				require.Nil(t, err)
+				require.Nil(t, actual)
+			})
+
+			t.Run("Nil Bytes", func(t *testing.T) {
+				tc := NewTyped[[]byte](cacher, nil, time.Minute)
+				require.Nil(t, tc.Set(m, t.Name(), nil))
+
+				actual, err := tc.Get(m, t.Name())
+				require.Nil(t, err)
+				require.Nil(t, actual)
+			})
+
+			t.Run("Not Found", func(t *testing.T) {
+				tc := NewTyped[string](cacher, nil, time.Minute)
+
+				_, err := tc.Get(m, t.Name())
+				require.Equal(t, ErrNotFound.Error(), err.Error())
+			})
+
+			t.Run("Delete", func(t *testing.T) {
+				tc := NewTyped[int](cacher, nil, time.Minute)
+				require.Nil(t, tc.Set(m, t.Name(), 42))
+				require.Nil(t, tc.Delete(m, t.Name()))
+
+				_, err := tc.Get(m, t.Name())
+				require.NotNil(t, err)
+			})
+		})
+	}
+}
+
+func TestGetTSetT(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	require.Nil(t, SetT(m, t.Name(), map[string]int{"a": 1}))
+
+	actual, err := GetT[map[string]int](m, t.Name())
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{"a": 1}, actual)
+}
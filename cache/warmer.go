@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WarmerOptions configures a Warmer.
+type WarmerOptions struct {
+	// RefreshAt is the fraction of a target's TTL after which it's refreshed. Defaults to 0.75.
+	RefreshAt float64
+
+	// Jitter is the most, in percent, that a refresh interval is randomly lengthened or shortened by,
+	// so that targets added together don't refresh together. Defaults to 10.
+	Jitter int
+
+	// OnError is called when a target fails to warm. Defaults to logging the failure.
+	OnError func(key string, err error)
+}
+
+// Warmer keeps cache entries populated, refreshing them ahead of expiry.
+type Warmer struct {
+	opts    WarmerOptions
+	targets []warmTarget
+}
+
+type warmTarget struct {
+	key  string
+	ttl  time.Duration
+	warm func(context.Context) error
+}
+
+// WarmErrors maps the keys that failed to warm to their errors.
+type WarmErrors map[string]error
+
+func (e WarmErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", k, e[k]))
+	}
+
+	return "cache warming failed for " + strings.Join(msgs, "; ")
+}
+
+// NewWarmer returns a Warmer configured by opts.
+func NewWarmer(opts WarmerOptions) *Warmer {
+	if opts.RefreshAt <= 0 || opts.RefreshAt > 1 {
+		opts.RefreshAt = 0.75
+	}
+
+	if opts.Jitter <= 0 {
+		opts.Jitter = 10
+	}
+
+	if opts.OnError == nil {
+		opts.OnError = func(key string, err error) {
+			log.Printf("cache: unable to warm %s: %s\n", key, err)
+		}
+	}
+
+	return &Warmer{opts: opts}
+}
+
+// Add keeps the value returned by loader cached at key for ttl. Targets must be added before calling Run.
+func (w *Warmer) Add(key string, ttl time.Duration, loader func(context.Context) (interface{}, error)) {
+	w.targets = append(w.targets, warmTarget{
+		key: key,
+		ttl: ttl,
+		warm: func(ctx context.Context) error {
+			v, err := loader(ctx)
+			if err != nil {
+				return err
+			}
+
+			return SetWithDurationContext(ctx, key, v, ttl)
+		},
+	})
+}
+
+// AddURL keeps the response to a GET of url cached, by replaying it through h ahead of ttl, the duration
+// the middleware caches it for. h must be wrapped by the cache middleware, which renders a fresh response
+// for the replayed request. Targets must be added before calling Run.
+func (w *Warmer) AddURL(h http.Handler, url string, ttl time.Duration) error {
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	w.AddRequest(h, r, ttl)
+	return nil
+}
+
+// AddRequest keeps the response to r cached, by replaying it through h ahead of ttl. See AddURL.
+func (w *Warmer) AddRequest(h http.Handler, r *http.Request, ttl time.Duration) {
+	w.targets = append(w.targets, warmTarget{
+		key: r.Method + " " + r.URL.String(),
+		ttl: ttl,
+		warm: func(ctx context.Context) error {
+			req := r.Clone(context.WithValue(ctx, refreshKey, true))
+			req.RequestURI = req.URL.RequestURI()
+
+			rw := &statusWriter{header: http.Header{}}
+			h.ServeHTTP(rw, req)
+
+			if rw.status >= 400 {
+				return fmt.Errorf("handler responded with status %d", rw.status)
+			}
+
+			if rw.header.Get("Cache-Control") == "no-cache" {
+				return errUncacheable
+			}
+
+			return nil
+		},
+	})
+}
+
+// Warm populates every target once, returning WarmErrors if any failed.
+func (w *Warmer) Warm(ctx context.Context) error {
+	var mu sync.Mutex
+	failed := WarmErrors{}
+
+	var wg sync.WaitGroup
+	for _, t := range w.targets {
+		wg.Add(1)
+		go func(t warmTarget) {
+			defer wg.Done()
+
+			if err := w.warm(ctx, t); err != nil {
+				mu.Lock()
+				failed[t.key] = err
+				mu.Unlock()
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return failed
+	}
+
+	return nil
+}
+
+// Run warms every target, then refreshes each ahead of its expiry until ctx is canceled. Run returns
+// once all in-progress refreshes have stopped.
+func (w *Warmer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range w.targets {
+		wg.Add(1)
+		go func(t warmTarget) {
+			defer wg.Done()
+			w.keepWarm(ctx, t)
+		}(t)
+	}
+
+	wg.Wait()
+}
+
+func (w *Warmer) keepWarm(ctx context.Context, t warmTarget) {
+	for {
+		w.warm(ctx, t)
+
+		// Values cached without expiry never need refreshing.
+		if t.ttl <= 0 {
+			return
+		}
+
+		timer := time.NewTimer(w.interval(t.ttl))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// warm populates a single target, reporting any failure.
+func (w *Warmer) warm(ctx context.Context, t warmTarget) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+
+		if err != nil {
+			w.opts.OnError(t.key, err)
+		}
+	}()
+
+	return t.warm(ctx)
+}
+
+// interval is how long to wait before refreshing a value cached for ttl.
+func (w *Warmer) interval(ttl time.Duration) time.Duration {
+	return FuzzDuration(time.Duration(float64(ttl)*w.opts.RefreshAt), 0, w.opts.Jitter)
+}
+
+// statusWriter is an http.ResponseWriter that records the status code, and discards the body.
+type statusWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *statusWriter) Header() http.Header         { return w.header }
+func (w *statusWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
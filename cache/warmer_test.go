@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmer(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	t.Run("Warm", func(t *testing.T) {
+		var mu sync.Mutex
+		reported := map[string]error{}
+
+		w := NewWarmer(WarmerOptions{OnError: func(key string, err error) {
+			mu.Lock()
+			reported[key] = err
+			mu.Unlock()
+		}})
+
+		failure := errors.New("loader failed")
+		w.Add("warm:ok", time.Minute, func(context.Context) (interface{}, error) { return "warmed", nil })
+		w.Add("warm:fail", time.Minute, func(context.Context) (interface{}, error) { return nil, failure })
+		w.Add("warm:panic", time.Minute, func(context.Context) (interface{}, error) { panic("oops") })
+
+		err := w.Warm(context.Background())
+		require.IsType(t, WarmErrors{}, err)
+		require.Len(t, err.(WarmErrors), 2)
+		require.Equal(t, failure, err.(WarmErrors)["warm:fail"])
+		require.Equal(t, err.(WarmErrors)["warm:fail"], reported["warm:fail"])
+		require.Contains(t, err.Error(), "warm:panic: panic: oops")
+
+		var s string
+		require.Nil(t, Get(m, "warm:ok", &s))
+		require.Equal(t, "warmed", s)
+	})
+
+	t.Run("Run Refreshes Until Canceled", func(t *testing.T) {
+		var calls int32
+		w := NewWarmer(WarmerOptions{RefreshAt: 0.5})
+		w.Add("warm:refresh", 40*time.Millisecond, func(context.Context) (interface{}, error) {
+			return atomic.AddInt32(&calls, 1), nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) >= 3 }, time.Second, 5*time.Millisecond)
+
+		var n int32
+		require.Nil(t, Get(m, "warm:refresh", &n))
+		require.GreaterOrEqual(t, n, int32(2))
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not stop after cancellation")
+		}
+
+		stopped := atomic.LoadInt32(&calls)
+		time.Sleep(50 * time.Millisecond)
+		require.Equal(t, stopped, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("URL Replay Bypasses Cache", func(t *testing.T) {
+		var calls int32
+		h := Middleware(60, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			if r.URL.Path == "/warm/missing" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Write([]byte{byte('0' + n)})
+		}))
+
+		w := NewWarmer(WarmerOptions{OnError: func(string, error) {}})
+		require.Nil(t, w.AddURL(h, "http://example.com/warm/page", time.Minute))
+
+		require.Nil(t, w.Warm(context.Background()))
+		require.Nil(t, w.Warm(context.Background()))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+		// Clients are served the most recently warmed response.
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/warm/page", nil))
+		require.Equal(t, "true", rw.Header().Get("X-Cache-Hit"))
+		require.Equal(t, "2", rw.Body.String())
+
+		require.Nil(t, w.AddURL(h, "http://example.com/warm/missing", time.Minute))
+		err := w.Warm(context.Background())
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "GET http://example.com/warm/missing: handler responded with status 404")
+	})
+}
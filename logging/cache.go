@@ -24,9 +24,11 @@ func CacheStatusFromContext(ctx context.Context) bool {
 	return cs
 }
 
-// CacheStatusFromHeaders returns true if the X-Cache-Hit header was set with the value "true".
+// CacheStatusFromHeaders returns true if the X-Cache-Hit header was set with the value "true",
+// or "STALE" for stale responses served from cache.
 func CacheStatusFromHeaders(h http.Header) bool {
-	return h.Get("X-Cache-Hit") == "true"
+	hit := h.Get("X-Cache-Hit")
+	return hit == "true" || hit == "STALE"
 }
 
 // RequestWithCacheStatus attaches a cache status to the request.
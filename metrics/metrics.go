@@ -16,6 +16,12 @@ type Recorder interface {
 	Segment(string) func()
 }
 
+// MetricRecorder is implemented by Recorders able to record custom metrics.
+type MetricRecorder interface {
+	// RecordMetric records a value for the named custom metric.
+	RecordMetric(string, float64)
+}
+
 var (
 	// MetricsRecorder is used by the GetRecorder function to determine which recorder
 	// to return. This allows an application to set a default recorder and simply call
@@ -26,9 +32,22 @@ var (
 	MetricsRecorder = "noop"
 )
 
-// GetRecorder returns an appropriate recorder based on the value of MetricsRecorder.
+// recorderKey is the key under which a Recorder is stored in context.
+type recorderKey struct{}
+
+// ContextWithRecorder returns a copy of ctx carrying r, which GetRecorder will return.
+func ContextWithRecorder(ctx context.Context, r Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// GetRecorder returns the Recorder attached to ctx by ContextWithRecorder, or otherwise an appropriate
+// recorder based on the value of MetricsRecorder.
 // Populate MetricsRecorder during setup in main to change which recorder is returned.
 func GetRecorder(ctx context.Context) Recorder {
+	if r, ok := ctx.Value(recorderKey{}).(Recorder); ok {
+		return r
+	}
+
 	switch MetricsRecorder {
 	case "newrelic":
 		return NewRelicFromContext(ctx)
@@ -36,3 +55,10 @@ func GetRecorder(ctx context.Context) Recorder {
 		return &NoOp{}
 	}
 }
+
+// RecordMetric records a value for the named custom metric, if r is able to record custom metrics.
+func RecordMetric(r Recorder, name string, value float64) {
+	if mr, ok := r.(MetricRecorder); ok {
+		mr.RecordMetric(name, value)
+	}
+}
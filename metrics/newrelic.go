@@ -70,6 +70,13 @@ func (nr *NewRelic) Segment(name string) func() {
 	return nr.Transaction.StartSegment(name).End
 }
 
+// RecordMetric records a value for the named custom metric. The name is prefixed with "Custom/" by NewRelic.
+func (nr *NewRelic) RecordMetric(name string, value float64) {
+	if app := nr.Transaction.Application(); app != nil {
+		app.RecordCustomMetric(name, value)
+	}
+}
+
 func argsToMap(args []interface{}) map[string]interface{} {
 	m := make(map[string]interface{})
 	for k, v := range args {
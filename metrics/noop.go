@@ -15,3 +15,6 @@ func (n *NoOp) Segment(string) func() {
 
 // SetDBMeta no-ops.
 func (n *NoOp) SetDBMeta(string, string, string) {}
+
+// RecordMetric no-ops.
+func (n *NoOp) RecordMetric(string, float64) {}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// MemorySlidingWindow returns a Limiter, held in memory by this process, that allows limit
+// requests per key within any period of length window. See SlidingWindow.
+func MemorySlidingWindow(limit int, window time.Duration) (Limiter, error) {
+	if limit <= 0 || window <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	return &memoryWindow{limit: limit, window: window, hits: cache.New(window, window)}, nil
+}
+
+// MemoryTokenBucket returns a Limiter, held in memory by this process, that allows bursts of up
+// to capacity requests per key, and a further request each interval. See TokenBucket.
+func MemoryTokenBucket(capacity int, interval time.Duration) (Limiter, error) {
+	if capacity <= 0 || interval <= 0 {
+		return nil, ErrInvalidLimit
+	}
+
+	full := time.Duration(capacity) * interval
+	return &memoryBucket{capacity: capacity, interval: interval, buckets: cache.New(full, full)}, nil
+}
+
+// memoryWindow records the times of the requests allowed for each key. Keys expire once their
+// requests have left the window.
+type memoryWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   *cache.Cache
+}
+
+func (l *memoryWindow) Allow(ctx context.Context, key string) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	var hits []time.Time
+	if v, ok := l.hits.Get(key); ok {
+		hits = v.([]time.Time)
+	}
+
+	// Drop the requests that have left the window.
+	i := 0
+	for i < len(hits) && !hits[i].After(now.Add(-l.window)) {
+		i++
+	}
+	hits = hits[i:]
+
+	res := Result{Limit: l.limit}
+	if len(hits) < l.limit {
+		hits = append(hits, now)
+		res.Allowed = true
+	}
+
+	res.Remaining = l.limit - len(hits)
+	res.Reset = hits[0].Add(l.window).Sub(now)
+	if !res.Allowed {
+		res.RetryAfter = res.Reset
+	}
+
+	l.hits.Set(key, hits, l.window)
+	return res, nil
+}
+
+// memoryBucket holds a bucket for each key. Keys expire once their bucket would be full.
+type memoryBucket struct {
+	mu       sync.Mutex
+	capacity int
+	interval time.Duration
+	buckets  *cache.Cache
+}
+
+type bucket struct {
+	tokens int
+	ts     time.Time
+}
+
+func (l *memoryBucket) Allow(ctx context.Context, key string) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	b := bucket{tokens: l.capacity, ts: now}
+	if v, ok := l.buckets.Get(key); ok {
+		b = v.(bucket)
+	}
+
+	if refill := int(now.Sub(b.ts) / l.interval); refill > 0 {
+		b.tokens += refill
+		b.ts = b.ts.Add(time.Duration(refill) * l.interval)
+	}
+	if b.tokens >= l.capacity {
+		b.tokens = l.capacity
+		b.ts = now
+	}
+
+	res := Result{Limit: l.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.interval - now.Sub(b.ts)
+	}
+
+	res.Remaining = b.tokens
+	if b.tokens < l.capacity {
+		res.Reset = time.Duration(l.capacity-b.tokens)*l.interval - now.Sub(b.ts)
+	}
+
+	l.buckets.Set(key, b, time.Duration(l.capacity)*l.interval)
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btm6084/utilities/remoteip"
+	"github.com/btm6084/utilities/response"
+)
+
+// KeyFunc identifies the client a request is counted against.
+type KeyFunc func(*http.Request) string
+
+// Options configures an instance of the rate limiting middleware.
+type Options struct {
+	// Limiter decides which requests are allowed.
+	Limiter Limiter
+
+	// KeyFunc identifies the client a request is counted against. Defaults to remoteip.Get, limiting
+	// each client across every route. See RouteKey.
+	KeyFunc KeyFunc
+
+	// FailClosed rejects requests when the Limiter fails. By default, they're allowed.
+	FailClosed bool
+}
+
+// RouteKey identifies a request by its client and route, limiting each route separately.
+func RouteKey(r *http.Request) string {
+	return remoteip.Get(r) + " " + r.Method + " " + r.URL.Path
+}
+
+// Middleware limits the rate of requests to the wrapped handler. Each response describes the
+// client's limit in RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. Requests over
+// the limit are refused with 429 Too Many Requests, and a Retry-After header.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	key := opts.KeyFunc
+	if key == nil {
+		key = remoteip.Get
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := opts.Limiter.Allow(r.Context(), key(r))
+			if err != nil {
+				log.Printf("ratelimit: unable to check rate limit: %s\n", err)
+
+				if opts.FailClosed {
+					response.ServeString(w, r, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+			if !res.Allowed {
+				retry := seconds(res.RetryAfter)
+				if retry < 1 {
+					retry = 1
+				}
+
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				response.ServeString(w, r, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
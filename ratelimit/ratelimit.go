@@ -0,0 +1,74 @@
+// Package ratelimit limits the rate of requests per client or route, with limits shared across
+// processes through redis, or held in memory.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/btm6084/utilities/redis"
+)
+
+var (
+	// KeyPrefix is prepended to the key of each limit stored in redis.
+	KeyPrefix = "ratelimit:"
+
+	// ErrInvalidLimit is returned when a limit or its period is not positive.
+	ErrInvalidLimit = errors.New("rate limit and period must be positive")
+)
+
+// Result is the outcome of checking a request against a rate limit.
+type Result struct {
+	// Allowed reports whether the request is within the limit.
+	Allowed bool
+
+	// Limit is the most requests allowed at once, and Remaining how many more are allowed now.
+	Limit     int
+	Remaining int
+
+	// RetryAfter is how long until a request will be allowed, when this one wasn't.
+	RetryAfter time.Duration
+
+	// Reset is how long until the full limit is available again.
+	Reset time.Duration
+}
+
+// Limiter decides whether a request identified by key is within a rate limit, counting it if so.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// LimiterFunc adapts a function to the Limiter interface.
+type LimiterFunc func(ctx context.Context, key string) (Result, error)
+
+// Allow calls f.
+func (f LimiterFunc) Allow(ctx context.Context, key string) (Result, error) {
+	return f(ctx, key)
+}
+
+// SlidingWindow returns a Limiter, shared through rdb, that allows limit requests per key within
+// any period of length window.
+func SlidingWindow(rdb redis.RateLimiter, limit int, window time.Duration) (Limiter, error) {
+	if limit <= 0 || window < time.Millisecond {
+		return nil, ErrInvalidLimit
+	}
+
+	return LimiterFunc(func(ctx context.Context, key string) (Result, error) {
+		rl, err := rdb.SlidingWindow(ctx, KeyPrefix+"window:"+key, limit, window)
+		return Result(rl), err
+	}), nil
+}
+
+// TokenBucket returns a Limiter, shared through rdb, that allows bursts of up to capacity requests
+// per key, and a further request each interval.
+func TokenBucket(rdb redis.RateLimiter, capacity int, interval time.Duration) (Limiter, error) {
+	if capacity <= 0 || interval < time.Millisecond {
+		return nil, ErrInvalidLimit
+	}
+
+	return LimiterFunc(func(ctx context.Context, key string) (Result, error) {
+		rl, err := rdb.TokenBucket(ctx, KeyPrefix+"bucket:"+key, capacity, interval)
+		return Result(rl), err
+	}), nil
+}
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiters(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.New(miniredis.RunT(t).Addr(), time.Second, "ratelimit_test")
+
+	windows := map[string]func(int, time.Duration) (Limiter, error){
+		"Redis": func(limit int, window time.Duration) (Limiter, error) {
+			return SlidingWindow(rdb, limit, window)
+		},
+		"Memory": MemorySlidingWindow,
+	}
+
+	for name, newLimiter := range windows {
+		t.Run("Sliding Window "+name, func(t *testing.T) {
+			l, err := newLimiter(3, 200*time.Millisecond)
+			require.Nil(t, err)
+
+			for remaining := 2; remaining >= 0; remaining-- {
+				res, err := l.Allow(ctx, "window")
+				require.Nil(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, 3, res.Limit)
+				require.Equal(t, remaining, res.Remaining)
+			}
+
+			res, err := l.Allow(ctx, "window")
+			require.Nil(t, err)
+			require.False(t, res.Allowed)
+			require.Equal(t, 0, res.Remaining)
+			require.Greater(t, res.RetryAfter, time.Duration(0))
+			require.LessOrEqual(t, res.RetryAfter, 200*time.Millisecond)
+
+			res, err = l.Allow(ctx, "other")
+			require.Nil(t, err)
+			require.True(t, res.Allowed)
+
+			time.Sleep(220 * time.Millisecond)
+			res, err = l.Allow(ctx, "window")
+			require.Nil(t, err)
+			require.True(t, res.Allowed)
+			require.Equal(t, 2, res.Remaining)
+		})
+	}
+
+	buckets := map[string]func(int, time.Duration) (Limiter, error){
+		"Redis": func(capacity int, interval time.Duration) (Limiter, error) {
+			return TokenBucket(rdb, capacity, interval)
+		},
+		"Memory": MemoryTokenBucket,
+	}
+
+	for name, newLimiter := range buckets {
+		t.Run("Token Bucket "+name, func(t *testing.T) {
+			l, err := newLimiter(2, 100*time.Millisecond)
+			require.Nil(t, err)
+
+			for remaining := 1; remaining >= 0; remaining-- {
+				res, err := l.Allow(ctx, "bucket")
+				require.Nil(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, remaining, res.Remaining)
+			}
+
+			res, err := l.Allow(ctx, "bucket")
+			require.Nil(t, err)
+			require.False(t, res.Allowed)
+			require.Greater(t, res.RetryAfter, time.Duration(0))
+			require.LessOrEqual(t, res.RetryAfter, 100*time.Millisecond)
+			require.LessOrEqual(t, res.Reset, 200*time.Millisecond)
+
+			// A single token is regained each interval.
+			time.Sleep(110 * time.Millisecond)
+			res, err = l.Allow(ctx, "bucket")
+			require.Nil(t, err)
+			require.True(t, res.Allowed)
+
+			res, err = l.Allow(ctx, "bucket")
+			require.Nil(t, err)
+			require.False(t, res.Allowed)
+		})
+	}
+
+	t.Run("Invalid Limits", func(t *testing.T) {
+		_, err := SlidingWindow(rdb, 0, time.Second)
+		require.Equal(t, ErrInvalidLimit, err)
+		_, err = TokenBucket(rdb, 1, 0)
+		require.Equal(t, ErrInvalidLimit, err)
+		_, err = MemorySlidingWindow(1, -time.Second)
+		require.Equal(t, ErrInvalidLimit, err)
+		_, err = MemoryTokenBucket(-1, time.Second)
+		require.Equal(t, ErrInvalidLimit, err)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	serve := func(h http.Handler, target, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Limits Each Client", func(t *testing.T) {
+		l, err := MemorySlidingWindow(1, time.Minute)
+		require.Nil(t, err)
+		h := Middleware(Options{Limiter: l})(ok)
+
+		w := serve(h, "/a", "54.146.177.1")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+
+		w = serve(h, "/b", "54.146.177.1")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Equal(t, "60", w.Header().Get("Retry-After"))
+		require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+		require.Equal(t, http.StatusOK, serve(h, "/a", "54.146.177.2").Code)
+	})
+
+	t.Run("Route Key", func(t *testing.T) {
+		l, err := MemorySlidingWindow(1, time.Minute)
+		require.Nil(t, err)
+		h := Middleware(Options{Limiter: l, KeyFunc: RouteKey})(ok)
+
+		require.Equal(t, http.StatusOK, serve(h, "/a", "54.146.177.1").Code)
+		require.Equal(t, http.StatusOK, serve(h, "/b", "54.146.177.1").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(h, "/a", "54.146.177.1").Code)
+	})
+
+	t.Run("Limiter Errors", func(t *testing.T) {
+		failing := LimiterFunc(func(context.Context, string) (Result, error) {
+			return Result{}, errors.New("unavailable")
+		})
+
+		w := serve(Middleware(Options{Limiter: failing})(ok), "/", "54.146.177.1")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+		w = serve(Middleware(Options{Limiter: failing, FailClosed: true})(ok), "/", "54.146.177.1")
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/cast"
+)
+
+// Compiler will enforce the interface and let us know if the contract is broken.
+var _ Batcher = (*Client)(nil)
+
+// GetMany returns the values at `keys` using a single MGET, or in cluster mode an MGET per hash
+// slot. Keys that couldn't be read are reported in the map of errors instead, with ErrNotFound for
+// keys that don't exist.
+func (c *Client) GetMany(r metrics.Recorder, keys []string) (map[string]interface{}, map[string]error) {
+	vals := map[string]interface{}{}
+	errs := map[string]error{}
+	if len(keys) == 0 {
+		return vals, errs
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = c.key(key)
+	}
+
+	r.SetDBMeta("Redis", strings.Join(namespaced, ","), "MGET "+cast.ToString(len(keys)))
+	defer r.DatabaseSegment("redis", "get many keys")()
+	for _, group := range c.slotGroups(namespaced) {
+		slotKeys := make([]string, len(group))
+		for j, i := range group {
+			slotKeys[j] = namespaced[i]
+		}
+
+		rsp := c.RDB.MGet(ctx, slotKeys...)
+		for j, i := range group {
+			switch {
+			case rsp.Err() != nil:
+				errs[keys[i]] = readErr(rsp.Err())
+			case rsp.Val()[j] == nil:
+				errs[keys[i]] = ErrNotFound
+			default:
+				vals[keys[i]] = rsp.Val()[j]
+			}
+		}
+	}
+
+	return vals, errs
+}
+
+// SetMany stores each of `values` at its key with the provided TTL, using a single pipeline.
+func (c *Client) SetMany(r metrics.Recorder, values map[string]interface{}, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	keys := make([]string, 0, len(values))
+	pipe := c.RDB.Pipeline()
+	for key, value := range values {
+		keys = append(keys, c.key(key))
+		pipe.Set(ctx, c.key(key), value, ttl)
+	}
+
+	r.SetDBMeta("Redis", strings.Join(keys, ","), "SET PIPE "+cast.ToString(len(keys)))
+	defer r.DatabaseSegment("redis", "set many keys", ttl)()
+	_, err := pipe.Exec(ctx)
+	return writeErr(err)
+}
+
+// DeleteMany removes the values at `keys` using a single DEL, or in cluster mode a DEL per hash slot.
+func (c *Client) DeleteMany(r metrics.Recorder, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = c.key(key)
+	}
+
+	r.SetDBMeta("Redis", strings.Join(namespaced, ","), "DEL "+cast.ToString(len(keys)))
+	defer r.DatabaseSegment("redis", "del many keys")()
+	return writeErr(c.del(ctx, c.RDB, namespaced))
+}
+
+// del removes keys from rdb, with a DEL per group of keys from slotGroups.
+func (c *Client) del(ctx context.Context, rdb redis.Cmdable, keys []string) error {
+	for _, group := range c.slotGroups(keys) {
+		slotKeys := make([]string, len(group))
+		for j, i := range group {
+			slotKeys[j] = keys[i]
+		}
+
+		if err := rdb.Del(ctx, slotKeys...).Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	return nil
+}
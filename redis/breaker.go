@@ -0,0 +1,262 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrCircuitOpen is returned by commands rejected while the circuit breaker of a Client is open.
+	// Cache reads made while the breaker is open return ErrNotFound instead, and cache writes are
+	// skipped. Commands whose result can't be skipped, such as Increment and Publish, return it.
+	ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ redis.Hook = (*Breaker)(nil)
+)
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every command through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen rejects every command with ErrCircuitOpen.
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single command through, to probe whether Redis has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// BreakerOptions configures a Breaker. Zero values take the defaults noted.
+type BreakerOptions struct {
+	// Failures is how many consecutive commands must fail to open the breaker. Defaults to 5.
+	Failures int
+
+	// SlowCall, if set, counts commands taking longer than this as failed, even if they succeed.
+	// Blocking commands, such as BLPOP or XREADGROUP with BLOCK, wait for data by design, and are
+	// exempt.
+	SlowCall time.Duration
+
+	// Cooldown is how long the breaker stays open before half opening. Defaults to 5s.
+	Cooldown time.Duration
+}
+
+// Breaker is a circuit breaker, installed as a go-redis Hook. It opens once Failures consecutive
+// commands fail with a network error or timeout, or take longer than SlowCall, after which commands
+// are rejected with ErrCircuitOpen rather than waiting on an unhealthy Redis. After Cooldown, the
+// breaker half opens and lets a single command through: if it succeeds the breaker closes, and if
+// not it opens again. Error replies from Redis, such as redis.Nil, don't count as failures.
+type Breaker struct {
+	opts BreakerOptions
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// breakerKey is the context key holding the breakerCall of a command.
+type breakerKey struct{}
+
+// breakerCall is a command let through by the Breaker.
+type breakerCall struct {
+	start time.Time
+
+	// probe is set for the command let through while half open.
+	probe bool
+
+	// blocking is set for commands that wait on the server for data, which aren't counted as slow.
+	blocking bool
+}
+
+// blockingCommands wait on the server for data, for as long as they're asked to.
+var blockingCommands = map[string]bool{
+	"blpop":      true,
+	"brpop":      true,
+	"brpoplpush": true,
+	"blmove":     true,
+	"blmpop":     true,
+	"bzpopmin":   true,
+	"bzpopmax":   true,
+	"bzmpop":     true,
+}
+
+// NewBreaker creates a closed Breaker.
+func NewBreaker(opts BreakerOptions) *Breaker {
+	if opts.Failures <= 0 {
+		opts.Failures = 5
+	}
+
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Second
+	}
+
+	return &Breaker{opts: opts}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// BeforeProcess rejects cmd with ErrCircuitOpen if the breaker is open.
+func (b *Breaker) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return b.before(ctx, isBlocking(cmd))
+}
+
+// AfterProcess records the outcome of cmd.
+func (b *Breaker) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	b.after(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline rejects cmds with ErrCircuitOpen if the breaker is open.
+func (b *Breaker) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return b.before(ctx, false)
+}
+
+// AfterProcessPipeline records the outcome of cmds, which fail together if any fails.
+func (b *Breaker) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if isBreakerFailure(cmd.Err()) {
+			err = cmd.Err()
+			break
+		}
+	}
+
+	b.after(ctx, err)
+	return nil
+}
+
+// before lets a command through, or returns ErrCircuitOpen.
+func (b *Breaker) before(ctx context.Context, blocking bool) (context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	call := breakerCall{start: time.Now(), blocking: blocking}
+	switch b.state {
+	case BreakerOpen:
+		if call.start.Sub(b.openedAt) < b.opts.Cooldown {
+			return ctx, ErrCircuitOpen
+		}
+
+		b.state = BreakerHalfOpen
+		call.probe = true
+
+	case BreakerHalfOpen:
+		// A probe is already in flight.
+		return ctx, ErrCircuitOpen
+	}
+
+	return context.WithValue(ctx, breakerKey{}, call), nil
+}
+
+// after records the outcome of a command let through by before.
+func (b *Breaker) after(ctx context.Context, err error) {
+	call, ok := ctx.Value(breakerKey{}).(breakerCall)
+	if !ok {
+		return
+	}
+
+	slow := !call.blocking && b.opts.SlowCall > 0 && time.Since(call.start) > b.opts.SlowCall
+	failed := isBreakerFailure(err) || slow
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Commands let through before the breaker opened don't affect it.
+	if !call.probe && b.state != BreakerClosed {
+		return
+	}
+
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if call.probe || b.failures >= b.opts.Failures {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.failures = 0
+	}
+}
+
+// isBlocking reports whether cmd waits on the server for data.
+func isBlocking(cmd redis.Cmder) bool {
+	name := cmd.Name()
+	if blockingCommands[name] {
+		return true
+	}
+
+	if name != "xread" && name != "xreadgroup" {
+		return false
+	}
+
+	// BLOCK comes before STREAMS, after which every argument is a stream or an ID.
+	for _, arg := range cmd.Args()[1:] {
+		s, _ := arg.(string)
+		switch {
+		case strings.EqualFold(s, "block"):
+			return true
+		case strings.EqualFold(s, "streams"):
+			return false
+		}
+	}
+
+	return false
+}
+
+// isBreakerFailure reports whether err suggests Redis is unhealthy, rather than being a reply from
+// Redis, or a command the caller gave up on.
+func isBreakerFailure(err error) bool {
+	if err == nil || err == ErrCircuitOpen || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// readErr maps ErrCircuitOpen to ErrNotFound, so that reads made while the breaker is open are misses.
+func readErr(err error) error {
+	if err == ErrCircuitOpen {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// writeErr maps ErrCircuitOpen to nil, so that writes made while the breaker is open are skipped.
+func writeErr(err error) error {
+	if err == ErrCircuitOpen {
+		return nil
+	}
+
+	return err
+}
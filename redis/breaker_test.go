@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	cooldown := 100 * time.Millisecond
+
+	rdb := NewWithOptions(ClientOptions{
+		Addr:           mr.Addr(),
+		RequestTimeout: time.Second,
+		MaxRetries:     -1,
+		Breaker:        &BreakerOptions{Failures: 2, Cooldown: cooldown},
+	})
+	defer rdb.RDB.Close()
+
+	require.Nil(t, rdb.Set(m, "key", "value"))
+	require.Equal(t, BreakerClosed, rdb.Breaker().State())
+
+	t.Run("Opens After Consecutive Failures", func(t *testing.T) {
+		mr.Close()
+
+		for i := 0; i < 2; i++ {
+			_, err := rdb.Get(m, "key")
+			require.NotNil(t, err)
+			require.NotEqual(t, ErrNotFound, err)
+		}
+		require.Equal(t, BreakerOpen, rdb.Breaker().State())
+
+		// Reads miss, and writes are skipped, without waiting on Redis.
+		_, err := rdb.Get(m, "key")
+		require.Equal(t, ErrNotFound, err)
+		require.Nil(t, rdb.Set(m, "key", "other"))
+		require.Nil(t, rdb.Delete(m, "key"))
+		require.Equal(t, ErrCircuitOpen, rdb.Ping(m))
+
+		// Counters have no value to return, and published messages would be lost.
+		_, err = rdb.Increment(m, "count", 1, time.Minute)
+		require.Equal(t, ErrCircuitOpen, err)
+		_, err = rdb.IncrementFloat(m, "count", 1.5, time.Minute)
+		require.Equal(t, ErrCircuitOpen, err)
+		require.Equal(t, ErrCircuitOpen, rdb.Publish(m, "channel", "message"))
+	})
+
+	t.Run("Failed Probe Reopens", func(t *testing.T) {
+		time.Sleep(cooldown)
+
+		_, err := rdb.Get(m, "key")
+		require.NotEqual(t, ErrNotFound, err)
+		require.Equal(t, BreakerOpen, rdb.Breaker().State())
+
+		_, err = rdb.Get(m, "key")
+		require.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Successful Probe Closes", func(t *testing.T) {
+		require.Nil(t, mr.Restart())
+		time.Sleep(cooldown)
+
+		val, err := rdb.Get(m, "key")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+		require.Equal(t, BreakerClosed, rdb.Breaker().State())
+	})
+
+	t.Run("Error Replies Don't Count", func(t *testing.T) {
+		mr.HSet("hash", "field", "value")
+
+		for i := 0; i < 3; i++ {
+			_, err := rdb.Get(m, "hash")
+			require.NotNil(t, err)
+			_, err = rdb.Get(m, "missing")
+			require.Equal(t, ErrNotFound, err)
+		}
+
+		require.Equal(t, BreakerClosed, rdb.Breaker().State())
+	})
+
+	t.Run("Slow Calls Count", func(t *testing.T) {
+		slow := NewWithOptions(ClientOptions{
+			Addr:    mr.Addr(),
+			Breaker: &BreakerOptions{Failures: 1, SlowCall: time.Nanosecond, Cooldown: time.Minute},
+		})
+		defer slow.RDB.Close()
+
+		val, err := slow.Get(m, "key")
+		require.Nil(t, err)
+		require.Equal(t, "value", val)
+		require.Equal(t, BreakerOpen, slow.Breaker().State())
+
+		_, err = slow.Get(m, "key")
+		require.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Blocking Reads Aren't Slow", func(t *testing.T) {
+		// miniredis doesn't answer blocking commands once restarted.
+		slow := NewWithOptions(ClientOptions{
+			Addr:    miniredis.RunT(t).Addr(),
+			Breaker: &BreakerOptions{Failures: 1, SlowCall: 10 * time.Millisecond, Cooldown: time.Minute},
+		})
+		defer slow.RDB.Close()
+
+		ctx := context.Background()
+		require.Nil(t, slow.RDB.XGroupCreateMkStream(ctx, "blocking", "group", "$").Err())
+		err := slow.RDB.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    "group",
+			Consumer: "consumer",
+			Streams:  []string{"blocking", ">"},
+			Block:    50 * time.Millisecond,
+		}).Err()
+		require.Equal(t, redis.Nil, err)
+		require.Equal(t, BreakerClosed, slow.Breaker().State())
+	})
+
+	t.Run("No Breaker", func(t *testing.T) {
+		plain := New(mr.Addr(), time.Second, "no_breaker")
+		defer plain.RDB.Close()
+
+		require.Nil(t, plain.Breaker())
+	})
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	for _, err := range []error{nil, ErrCircuitOpen, context.Canceled, fmt.Errorf("get: %w", context.Canceled), redis.Nil, redis.TxFailedErr} {
+		require.False(t, isBreakerFailure(err), "%v", err)
+	}
+
+	for _, err := range []error{context.DeadlineExceeded, io.EOF, errors.New("dial tcp: connection refused")} {
+		require.True(t, isBreakerFailure(err), "%v", err)
+	}
+}
+
+func TestBreakerSubscribe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cooldown := 50 * time.Millisecond
+
+	rdb := NewWithOptions(ClientOptions{
+		Addr:           mr.Addr(),
+		RequestTimeout: time.Second,
+		MaxRetries:     -1,
+		Breaker:        &BreakerOptions{Failures: 1, SlowCall: 10 * time.Millisecond, Cooldown: cooldown},
+	})
+	defer rdb.RDB.Close()
+
+	bus := NewStreamBus(rdb, StreamOptions{Block: 50 * time.Millisecond})
+	sctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Subscribe waits out the cooldown of an open breaker.
+	ctx, err := rdb.Breaker().before(context.Background(), false)
+	require.Nil(t, err)
+	rdb.Breaker().after(ctx, io.EOF)
+	require.Equal(t, BreakerOpen, rdb.Breaker().State())
+
+	msgs := make(chan Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.Subscribe(sctx, "topic", func(_ context.Context, msg Message) error {
+			msgs <- msg
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		return rdb.Breaker().State() == BreakerClosed
+	}, time.Second, 10*time.Millisecond)
+
+	// Idle polls block for longer than SlowCall, without opening the breaker.
+	time.Sleep(3 * cooldown)
+	require.Equal(t, BreakerClosed, rdb.Breaker().State())
+
+	require.Nil(t, bus.Publish(context.Background(), "topic", "payload"))
+	select {
+	case msg := <-msgs:
+		require.Equal(t, "payload", msg.Payload)
+	case err := <-done:
+		require.FailNow(t, "subscribe returned", "%v", err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "message not received")
+	}
+
+	cancel()
+	require.Nil(t, <-done)
+}
+
+func TestClusterBreaker(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	cooldown := 100 * time.Millisecond
+
+	rdb := NewCluster(ClusterOptions{
+		Addrs: []string{mr.Addr()},
+		ClientOptions: ClientOptions{
+			RequestTimeout: time.Second,
+			MaxRetries:     -1,
+			Breaker:        &BreakerOptions{Failures: 2, Cooldown: cooldown},
+		},
+	})
+	defer rdb.RDB.Close()
+
+	require.Nil(t, rdb.Set(m, "prefix:key", "value"))
+	require.NotNil(t, rdb.Breaker())
+
+	mr.Close()
+	require.Eventually(t, func() bool {
+		rdb.Get(m, "prefix:key")
+		return rdb.Breaker().State() == BreakerOpen
+	}, time.Second, 10*time.Millisecond)
+
+	// Commands sent to every node pass through the breaker too.
+	require.Nil(t, rdb.DeletePrefix(m, "prefix:"))
+	require.Nil(t, rdb.Set(m, "prefix:key", "other"))
+
+	// Each command passes through the breaker once, so the probe isn't rejected by itself.
+	require.Nil(t, mr.Restart())
+	time.Sleep(cooldown)
+
+	val, err := rdb.Get(m, "prefix:key")
+	require.Nil(t, err)
+	require.Equal(t, "value", val)
+	require.Equal(t, BreakerClosed, rdb.Breaker().State())
+}
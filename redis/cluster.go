@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// clusterSlots is the number of hash slots keys are distributed over in a Redis Cluster.
+const clusterSlots = 16384
+
+// FailoverOptions configures a Client for a Sentinel managed deployment. ClientOptions.Addr is
+// ignored, as the address of the master is provided by the sentinels.
+type FailoverOptions struct {
+	ClientOptions
+
+	// MasterName is the name sentinels monitor the master under.
+	MasterName string
+
+	// SentinelAddrs are the host:port of each sentinel.
+	SentinelAddrs []string
+
+	// SentinelUsername and SentinelPassword authenticate connections to the sentinels.
+	SentinelUsername string
+	SentinelPassword string
+}
+
+// ClusterOptions configures a Client for a Redis Cluster. ClientOptions.Addr and DB are ignored.
+//
+// Commands touching several keys, such as GetMany and DeleteMany, are split by hash slot. Keys
+// stored with tags by SetWithTags must share a hash slot with their tags, by way of a {hash tag}.
+type ClusterOptions struct {
+	ClientOptions
+
+	// Addrs are the host:port of one or more cluster nodes, from which the rest are discovered.
+	Addrs []string
+}
+
+// NewFailover creates a new client for the master of a Sentinel managed deployment. Commands are
+// sent to the new master following a failover.
+func NewFailover(opts FailoverOptions) *Client {
+	return newClient(opts.ClientOptions, redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:       opts.MasterName,
+		SentinelAddrs:    opts.SentinelAddrs,
+		SentinelUsername: opts.SentinelUsername,
+		SentinelPassword: opts.SentinelPassword,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		DB:               opts.DB,
+		TLSConfig:        opts.TLSConfig,
+		PoolSize:         opts.PoolSize,
+		MinIdleConns:     opts.MinIdleConns,
+		DialTimeout:      opts.DialTimeout,
+		ReadTimeout:      opts.ReadTimeout,
+		WriteTimeout:     opts.WriteTimeout,
+		MaxRetries:       opts.MaxRetries,
+		MinRetryBackoff:  opts.MinRetryBackoff,
+		MaxRetryBackoff:  opts.MaxRetryBackoff,
+		OnConnect:        onConnect(opts.ClientName),
+	}))
+}
+
+// NewCluster creates a new client for a Redis Cluster. Its circuit breaker, if any, is installed on
+// the client for each node, so that commands sent to every node, such as by Scan, pass through it.
+func NewCluster(opts ClusterOptions) *Client {
+	var breaker *Breaker
+	if opts.Breaker != nil {
+		breaker = NewBreaker(*opts.Breaker)
+	}
+
+	// Every command reaches the cluster through a node client, so the breaker isn't also installed on
+	// the cluster client, where it would see each command twice.
+	copts := opts.ClientOptions
+	copts.Breaker = nil
+
+	c := newClient(copts, redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:           opts.Addrs,
+		Username:        opts.Username,
+		Password:        opts.Password,
+		TLSConfig:       opts.TLSConfig,
+		PoolSize:        opts.PoolSize,
+		MinIdleConns:    opts.MinIdleConns,
+		DialTimeout:     opts.DialTimeout,
+		ReadTimeout:     opts.ReadTimeout,
+		WriteTimeout:    opts.WriteTimeout,
+		MaxRetries:      opts.MaxRetries,
+		MinRetryBackoff: opts.MinRetryBackoff,
+		MaxRetryBackoff: opts.MaxRetryBackoff,
+		OnConnect:       onConnect(opts.ClientName),
+		NewClient: func(o *redis.Options) *redis.Client {
+			node := redis.NewClient(o)
+			if breaker != nil {
+				node.AddHook(breaker)
+			}
+
+			return node
+		},
+	}))
+
+	c.breaker = breaker
+	return c
+}
+
+// isCluster reports whether the client is connected to a Redis Cluster.
+func (c *Client) isCluster() bool {
+	_, ok := c.RDB.(*redis.ClusterClient)
+	return ok
+}
+
+// slotGroups splits keys, by index, into groups that may be sent in a single multi-key command or
+// transaction. In cluster mode, each group holds the keys of one hash slot, in the order the slot
+// first appears. Otherwise, every key is in a single group.
+func (c *Client) slotGroups(keys []string) [][]int {
+	if !c.isCluster() {
+		group := make([]int, len(keys))
+		for i := range keys {
+			group[i] = i
+		}
+
+		return [][]int{group}
+	}
+
+	var groups [][]int
+	bySlot := map[int]int{}
+	for i, key := range keys {
+		slot := keySlot(key)
+
+		g, ok := bySlot[slot]
+		if !ok {
+			g = len(groups)
+			bySlot[slot] = g
+			groups = append(groups, nil)
+		}
+
+		groups[g] = append(groups[g], i)
+	}
+
+	return groups
+}
+
+// keySlot returns the cluster hash slot of key. Only the {hash tag} of a key is hashed, if it has one.
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 is the CRC-16/XMODEM checksum Redis Cluster hashes keys with.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,144 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster(t *testing.T) {
+	m := &metrics.NoOp{}
+
+	// miniredis answers CLUSTER SLOTS as a single node holding every slot.
+	mr := miniredis.RunT(t)
+	rdb := NewCluster(ClusterOptions{Addrs: []string{mr.Addr()}})
+	defer rdb.RDB.Close()
+
+	require.Nil(t, rdb.Set(m, "cluster", "value"))
+	val, err := rdb.Get(m, "cluster")
+	require.Nil(t, err)
+	require.Equal(t, "value", val)
+
+	// These keys hash to different slots.
+	keys := []string{"foo", "bar", "{foo}baz"}
+	require.Nil(t, rdb.SetMany(m, map[string]interface{}{"foo": "1", "bar": "2", "{foo}baz": "3"}, time.Minute))
+
+	vals, errs := rdb.GetMany(m, append(keys, "missing"))
+	require.Equal(t, map[string]interface{}{"foo": "1", "bar": "2", "{foo}baz": "3"}, vals)
+	require.Equal(t, map[string]error{"missing": ErrNotFound}, errs)
+
+	for i, key := range keys {
+		require.Nil(t, rdb.IncrementHash(m, "hash:"+key, "count", i+1))
+	}
+
+	hashes, err := rdb.GetHashSet(m, []string{"hash:foo", "hash:bar", "hash:{foo}baz"})
+	require.Nil(t, err)
+	require.Equal(t, []map[string]string{{"count": "1"}, {"count": "2"}, {"count": "3"}}, hashes)
+
+	require.Nil(t, rdb.DeletePrefix(m, "hash:"))
+	require.False(t, mr.Exists("hash:foo"))
+	require.False(t, mr.Exists("hash:bar"))
+
+	require.Nil(t, rdb.DeleteMany(m, keys))
+	_, errs = rdb.GetMany(m, keys)
+	require.Len(t, errs, 3)
+}
+
+func TestFailover(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+
+	// A stand-in sentinel that reports mr as the master of "primary".
+	sentinel, err := server.NewServer("127.0.0.1:0")
+	require.Nil(t, err)
+	defer sentinel.Close()
+
+	host, port, _ := strings.Cut(mr.Addr(), ":")
+	sentinel.Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == "primary":
+			c.WriteStrings([]string{host, port})
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name"):
+			c.WriteNull()
+		default:
+			c.WriteLen(0)
+		}
+	})
+	sentinel.Register("CLIENT", func(c *server.Peer, cmd string, args []string) {
+		c.WriteOK()
+	})
+	sentinel.Register("SUBSCRIBE", func(c *server.Peer, cmd string, args []string) {
+		for i, channel := range args {
+			c.WriteLen(3)
+			c.WriteBulk("subscribe")
+			c.WriteBulk(channel)
+			c.WriteInt(i + 1)
+		}
+	})
+
+	rdb := NewFailover(FailoverOptions{
+		ClientOptions: ClientOptions{ClientName: "failover_test", DB: 2},
+		MasterName:    "primary",
+		SentinelAddrs: []string{sentinel.Addr().String()},
+	})
+	defer rdb.RDB.Close()
+
+	require.Nil(t, rdb.Set(m, "failover", "value"))
+	stored, err := mr.DB(2).Get("failover")
+	require.Nil(t, err)
+	require.Equal(t, "value", stored)
+
+	name, err := rdb.RDB.ClientGetName(context.Background()).Result()
+	require.Nil(t, err)
+	require.Equal(t, "failover_test", name)
+
+	unknown := NewFailover(FailoverOptions{
+		ClientOptions: ClientOptions{MaxRetries: -1},
+		MasterName:    "unknown",
+		SentinelAddrs: []string{sentinel.Addr().String()},
+	})
+	defer unknown.RDB.Close()
+
+	require.NotNil(t, unknown.Ping(m))
+}
+
+func TestKeySlot(t *testing.T) {
+	// CRC-16/XMODEM check value, and slots as reported by CLUSTER KEYSLOT.
+	require.Equal(t, uint16(0x31C3), crc16("123456789"))
+	require.Equal(t, 12182, keySlot("foo"))
+	require.Equal(t, 5061, keySlot("bar"))
+
+	// Only the hash tag is hashed, so that related keys share a slot.
+	require.Equal(t, keySlot("user1000"), keySlot("{user1000}.following"))
+	require.Equal(t, keySlot("user1000"), keySlot("{user1000}.followers"))
+	require.Equal(t, keySlot("foo"), keySlot("{foo}baz"))
+	require.Equal(t, keySlot("bar"), keySlot("foo{bar}{zap}"))
+	require.Equal(t, keySlot("{bar"), keySlot("foo{{bar}}zap"))
+
+	// An empty hash tag doesn't count, and the whole key is hashed.
+	require.Equal(t, int(crc16("{}foo")%clusterSlots), keySlot("{}foo"))
+	require.NotEqual(t, keySlot("foo"), keySlot("{}foo"))
+	require.Equal(t, int(crc16("foo{}{bar}")%clusterSlots), keySlot("foo{}{bar}"))
+}
+
+func TestSlotGroups(t *testing.T) {
+	keys := []string{"foo", "bar", "{foo}baz", "{bar}qux", "zap", "foo"}
+
+	cluster := NewCluster(ClusterOptions{Addrs: []string{"127.0.0.1:0"}})
+	defer cluster.RDB.Close()
+
+	// Groups are ordered by the first key in each slot, and keep the order of their keys.
+	require.Equal(t, [][]int{{0, 2, 5}, {1, 3}, {4}}, cluster.slotGroups(keys))
+	require.Empty(t, cluster.slotGroups(nil))
+
+	single := New("127.0.0.1:0", time.Second, "slot_groups_test")
+	defer single.RDB.Close()
+
+	require.Equal(t, [][]int{{0, 1, 2, 3, 4, 5}}, single.slotGroups(keys))
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// increment adds to a counter, and sets its TTL if it has none.
+	//
+	// KEYS[1] is the counter. ARGV[1] is the amount, ARGV[2] the TTL in ms, or 0 for none.
+	increment = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+	// incrementFloat adds to a floating point counter, and sets its TTL if it has none. The new
+	// value is returned as a string, as Lua numbers are truncated to integers in replies.
+	//
+	// KEYS[1] is the counter. ARGV[1] is the amount, ARGV[2] the TTL in ms, or 0 for none.
+	incrementFloat = redis.NewScript(`
+local v = redis.call('INCRBYFLOAT', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+	// incrementHash adds to a field of a hash, and sets the TTL of the hash if it has none.
+	//
+	// KEYS[1] is the hash. ARGV[1] is the field, ARGV[2] the amount, ARGV[3] the TTL in ms, or 0 for none.
+	incrementHash = redis.NewScript(`
+local v = redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 and redis.call('PTTL', KEYS[1]) == -1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return v
+`)
+)
+
+// Increment adds amount to the counter at `key`, returning its new value. The increment and expiry
+// are applied atomically, and the TTL is only set if the counter has none, so that it expires ttl
+// after it was created. A ttl <= 0 sets no expiry. Returns ErrCircuitOpen while the circuit breaker
+// is open, as there's no value to return.
+func (c *Client) Increment(r metrics.Recorder, key string, amount int64, ttl time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "EVALSHA INCRBY")
+	defer r.DatabaseSegment("redis", "increment", amount, ttl)()
+	v, err := increment.Run(ctx, c.RDB, []string{key}, amount, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+// IncrementFloat adds amount to the floating point counter at `key`, returning its new value. See Increment.
+func (c *Client) IncrementFloat(r metrics.Recorder, key string, amount float64, ttl time.Duration) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "EVALSHA INCRBYFLOAT")
+	defer r.DatabaseSegment("redis", "increment float", amount, ttl)()
+	v, err := incrementFloat.Run(ctx, c.RDB, []string{key}, strconv.FormatFloat(amount, 'f', -1, 64), ttl.Milliseconds()).Text()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(v, 64)
+}
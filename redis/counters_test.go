@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounters(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	rdb := New(mr.Addr(), time.Second, "counters_test")
+
+	t.Run("Increment", func(t *testing.T) {
+		v, err := rdb.Increment(m, "count", 2, time.Minute)
+		require.Nil(t, err)
+		require.Equal(t, int64(2), v)
+		require.Equal(t, time.Minute, mr.TTL("count"))
+
+		// The TTL is kept from the first increment.
+		mr.FastForward(30 * time.Second)
+		v, err = rdb.Increment(m, "count", -5, time.Minute)
+		require.Nil(t, err)
+		require.Equal(t, int64(-3), v)
+		require.Equal(t, 30*time.Second, mr.TTL("count"))
+
+		v, err = rdb.Increment(m, "forever", 1, 0)
+		require.Nil(t, err)
+		require.Equal(t, int64(1), v)
+		require.Equal(t, time.Duration(0), mr.TTL("forever"))
+	})
+
+	t.Run("Increment Float", func(t *testing.T) {
+		v, err := rdb.IncrementFloat(m, "float", 1.5, time.Minute)
+		require.Nil(t, err)
+		require.Equal(t, 1.5, v)
+
+		v, err = rdb.IncrementFloat(m, "float", 0.25, time.Minute)
+		require.Nil(t, err)
+		require.Equal(t, 1.75, v)
+		require.Equal(t, time.Minute, mr.TTL("float"))
+	})
+
+	t.Run("Increment Hash Sets TTL Once", func(t *testing.T) {
+		require.Nil(t, rdb.IncrementHashWithDuration(m, "hits", "a", 1, time.Minute))
+		mr.FastForward(30 * time.Second)
+		require.Nil(t, rdb.IncrementHashWithDuration(m, "hits", "b", 2, time.Minute))
+		require.Equal(t, 30*time.Second, mr.TTL("hits"))
+
+		hash, err := rdb.GetHash(m, "hits")
+		require.Nil(t, err)
+		require.Equal(t, map[string]string{"a": "1", "b": "2"}, hash)
+
+		// A hash without a TTL gets one.
+		mr.HSet("untimed", "a", "1")
+		require.Nil(t, rdb.IncrementHashWithDuration(m, "untimed", "a", 1, time.Minute))
+		require.Equal(t, time.Minute, mr.TTL("untimed"))
+	})
+
+	t.Run("Concurrent First Increment", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.Nil(t, rdb.IncrementHashWithDuration(m, "racing", "count", 1, time.Minute))
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, time.Minute, mr.TTL("racing"))
+		require.Equal(t, "20", mr.HGet("racing", "count"))
+	})
+
+	t.Run("Hash Fields", func(t *testing.T) {
+		_, err := rdb.GetHash(m, "fields")
+		require.Equal(t, ErrNotFound, err)
+
+		require.Nil(t, rdb.SetHashFields(m, "fields", map[string]interface{}{"a": "1", "b": 2}, time.Minute))
+		require.Nil(t, rdb.SetHashFields(m, "fields", map[string]interface{}{"c": "3"}, 2*time.Minute))
+		require.Equal(t, 2*time.Minute, mr.TTL("fields"))
+
+		require.Nil(t, rdb.DeleteHashFields(m, "fields", "a", "missing"))
+		hash, err := rdb.GetHash(m, "fields")
+		require.Nil(t, err)
+		require.Equal(t, map[string]string{"b": "2", "c": "3"}, hash)
+
+		require.Nil(t, rdb.SetHashFields(m, "fields", map[string]interface{}{"d": "4"}, 0))
+		require.Equal(t, time.Duration(0), mr.TTL("fields"))
+	})
+
+	t.Run("Noop", func(t *testing.T) {
+		n := &Noop{}
+		v, err := n.Increment(m, "noop", 1, time.Minute)
+		require.Nil(t, err)
+		require.Equal(t, int64(0), v)
+
+		_, err = n.GetHash(m, "noop")
+		require.Equal(t, ErrNotFound, err)
+		require.Nil(t, n.SetHashFields(m, "noop", map[string]interface{}{"a": 1}, time.Minute))
+		require.Nil(t, n.DeleteHashFields(m, "noop", "a"))
+	})
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	"github.com/btm6084/utilities/metrics"
@@ -18,4 +19,41 @@ type Cache interface {
 	IncrementHash(metrics.Recorder, string, string, int) error
 	IncrementHashWithDuration(metrics.Recorder, string, string, int, time.Duration) error
 	GetHashSet(metrics.Recorder, []string) ([]map[string]string, error)
+	Increment(metrics.Recorder, string, int64, time.Duration) (int64, error)
+	IncrementFloat(metrics.Recorder, string, float64, time.Duration) (float64, error)
+	GetHash(metrics.Recorder, string) (map[string]string, error)
+	SetHashFields(metrics.Recorder, string, map[string]interface{}, time.Duration) error
+	DeleteHashFields(metrics.Recorder, string, ...string) error
+}
+
+// ContextCache is implemented by Caches whose operations accept a context, so that canceling the
+// context abandons the operation. The Recorder is taken from the context by metrics.GetRecorder.
+type ContextCache interface {
+	GetStringContext(context.Context, string) (string, error)
+	GetContext(context.Context, string) (interface{}, error)
+	TTLContext(context.Context, string) (time.Duration, error)
+	SetContext(context.Context, string, interface{}) error
+	SetWithDurationContext(context.Context, string, interface{}, time.Duration) error
+	DeleteContext(context.Context, string) error
+}
+
+// PubSub publishes and receives messages over named channels.
+type PubSub interface {
+	Publish(metrics.Recorder, string, string) error
+	Subscribe(context.Context, string) (<-chan string, error)
+}
+
+// Tagger groups keys under tags, so that related keys may be removed together.
+type Tagger interface {
+	SetWithTags(metrics.Recorder, string, interface{}, time.Duration, ...string) error
+	InvalidateTag(metrics.Recorder, string) error
+	DeletePrefix(metrics.Recorder, string) error
+}
+
+// Batcher reads and writes many keys in a single round trip. GetMany reports each key that
+// couldn't be read in its map of errors, with ErrNotFound for keys that don't exist.
+type Batcher interface {
+	GetMany(metrics.Recorder, []string) (map[string]interface{}, map[string]error)
+	SetMany(metrics.Recorder, map[string]interface{}, time.Duration) error
+	DeleteMany(metrics.Recorder, []string) error
 }
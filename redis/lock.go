@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrLockHeld is returned when a lock is already held by another owner.
+	ErrLockHeld = errors.New("lock is held by another owner")
+
+	// ErrLockNotHeld is returned when refreshing or releasing a lock that has expired, or been taken
+	// by another owner since.
+	ErrLockNotHeld = errors.New("lock is not held")
+
+	// lockRetryInterval is how often Lock retries a lock held by another owner.
+	lockRetryInterval = 50 * time.Millisecond
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Locker = (*Client)(nil)
+
+	// refreshLock extends the TTL of a lock if it's still held with the given token.
+	//
+	// KEYS[1] is the lock. ARGV[1] is the token, ARGV[2] the TTL in ms.
+	refreshLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+	// releaseLock removes a lock if it's still held with the given token.
+	//
+	// KEYS[1] is the lock. ARGV[1] is the token.
+	releaseLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Lock is a lock held across processes until it's released or its TTL expires. The Recorder
+// used by each method is taken from ctx by metrics.GetRecorder.
+type Lock interface {
+	// Refresh extends the lock to expire ttl from now. Returns ErrLockNotHeld if the lock was lost.
+	Refresh(ctx context.Context, ttl time.Duration) error
+
+	// Unlock releases the lock. Returns ErrLockNotHeld if the lock was lost.
+	Unlock(ctx context.Context) error
+}
+
+// Locker takes locks held across processes.
+type Locker interface {
+	Lock(context.Context, string, time.Duration) (Lock, error)
+	TryLock(context.Context, string, time.Duration) (Lock, error)
+}
+
+// redisLock is a lock on key, identified as ours by token.
+type redisLock struct {
+	c     *Client
+	key   string
+	token string
+}
+
+// Lock takes the lock at `key` for ttl, waiting until it's available or ctx is canceled.
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	for {
+		l, err := c.TryLock(ctx, key, ttl)
+		if err != ErrLockHeld {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// TryLock takes the lock at `key` for ttl, returning ErrLockHeld if another owner holds it.
+func (c *Client) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "SET NX")
+	defer r.DatabaseSegment("redis", "lock", ttl)()
+	acquired, err := c.RDB.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !acquired {
+		return nil, ErrLockHeld
+	}
+
+	return &redisLock{c: c, key: key, token: token}, nil
+}
+
+// Refresh extends the lock to expire ttl from now.
+func (l *redisLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, l.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", l.key, "EVALSHA PEXPIRE")
+	defer r.DatabaseSegment("redis", "refresh lock", ttl)()
+	n, err := refreshLock.Run(ctx, l.c.RDB, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// Unlock releases the lock.
+func (l *redisLock) Unlock(ctx context.Context) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, l.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", l.key, "EVALSHA DEL")
+	defer r.DatabaseSegment("redis", "unlock")()
+	n, err := releaseLock.Run(ctx, l.c.RDB, []string{l.key}, l.token).Int()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// lockToken returns a random token identifying the owner of a lock.
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
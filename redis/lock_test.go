@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := New(mr.Addr(), time.Second, "lock_test")
+	ctx := context.Background()
+
+	t.Run("Exclusive", func(t *testing.T) {
+		lock, err := rdb.TryLock(ctx, "exclusive", time.Minute)
+		require.Nil(t, err)
+
+		_, err = rdb.TryLock(ctx, "exclusive", time.Minute)
+		require.Equal(t, ErrLockHeld, err)
+
+		require.Nil(t, lock.Unlock(ctx))
+		require.False(t, mr.Exists("exclusive"))
+
+		lock, err = rdb.TryLock(ctx, "exclusive", time.Minute)
+		require.Nil(t, err)
+		require.Nil(t, lock.Unlock(ctx))
+	})
+
+	t.Run("Waits For Release", func(t *testing.T) {
+		held, err := rdb.Lock(ctx, "wait", time.Minute)
+		require.Nil(t, err)
+
+		time.AfterFunc(100*time.Millisecond, func() { held.Unlock(ctx) })
+
+		start := time.Now()
+		lock, err := rdb.Lock(ctx, "wait", time.Minute)
+		require.Nil(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		require.Nil(t, lock.Unlock(ctx))
+	})
+
+	t.Run("Gives Up When Canceled", func(t *testing.T) {
+		held, err := rdb.Lock(ctx, "canceled", time.Minute)
+		require.Nil(t, err)
+		defer held.Unlock(ctx)
+
+		wctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		_, err = rdb.Lock(wctx, "canceled", time.Minute)
+		require.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("Can't Release Another Owner's Lock", func(t *testing.T) {
+		stale, err := rdb.TryLock(ctx, "owned", time.Second)
+		require.Nil(t, err)
+
+		mr.FastForward(2 * time.Second)
+
+		current, err := rdb.TryLock(ctx, "owned", time.Minute)
+		require.Nil(t, err)
+
+		require.Equal(t, ErrLockNotHeld, stale.Refresh(ctx, time.Minute))
+		require.Equal(t, ErrLockNotHeld, stale.Unlock(ctx))
+		require.True(t, mr.Exists("owned"))
+
+		require.Nil(t, current.Unlock(ctx))
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		lock, err := rdb.TryLock(ctx, "refresh", time.Second)
+		require.Nil(t, err)
+
+		require.Nil(t, lock.Refresh(ctx, time.Minute))
+		require.Equal(t, time.Minute, mr.TTL("refresh"))
+		require.Nil(t, lock.Unlock(ctx))
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		Namespace = "ns:"
+		defer func() { Namespace = "" }()
+
+		lock, err := rdb.TryLock(ctx, "namespaced", time.Minute)
+		require.Nil(t, err)
+		require.True(t, mr.Exists("ns:namespaced"))
+		require.Nil(t, lock.Unlock(ctx))
+	})
+
+	t.Run("Noop", func(t *testing.T) {
+		n := &Noop{}
+		a, err := n.TryLock(ctx, "noop", time.Minute)
+		require.Nil(t, err)
+		b, err := n.Lock(ctx, "noop", time.Minute)
+		require.Nil(t, err)
+
+		require.Nil(t, a.Refresh(ctx, time.Minute))
+		require.Nil(t, a.Unlock(ctx))
+		require.Nil(t, b.Unlock(ctx))
+	})
+}
@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Publisher  = (*MemoryBus)(nil)
+	_ Subscriber = (*MemoryBus)(nil)
+)
+
+// MemoryBus is an in-memory Publisher and Subscriber with the delivery semantics of StreamBus, for
+// use in tests and single process deployments.
+type MemoryBus struct {
+	opts   StreamOptions
+	topics *memoryTopics
+}
+
+// memoryTopics holds the topics of a MemoryBus, shared by each MemoryBus made by WithOptions.
+type memoryTopics struct {
+	mu      sync.Mutex
+	seq     uint64
+	streams map[string]*memoryStream
+}
+
+// memoryStream is a topic's messages, and the consumer groups reading them.
+type memoryStream struct {
+	entries []memoryEntry
+	groups  map[string]*memoryGroup
+
+	// published is closed, and replaced, when a message is published.
+	published chan struct{}
+}
+
+type memoryEntry struct {
+	seq     uint64
+	id      string
+	payload string
+}
+
+// memoryGroup tracks the messages a consumer group has read, and those it hasn't acknowledged.
+type memoryGroup struct {
+	// next is the seq of the first message not yet delivered to the group.
+	next    uint64
+	pending map[string]*memoryPending
+}
+
+type memoryPending struct {
+	entry      memoryEntry
+	delivered  time.Time
+	deliveries int
+}
+
+// NewMemoryBus creates an empty MemoryBus.
+func NewMemoryBus(opts StreamOptions) *MemoryBus {
+	return &MemoryBus{
+		opts:   opts.withDefaults(),
+		topics: &memoryTopics{streams: map[string]*memoryStream{}},
+	}
+}
+
+// WithOptions returns a MemoryBus sharing the topics of b, e.g. to subscribe as another group.
+func (b *MemoryBus) WithOptions(opts StreamOptions) *MemoryBus {
+	return &MemoryBus{opts: opts.withDefaults(), topics: b.topics}
+}
+
+// Publish appends a message to `topic`.
+func (b *MemoryBus) Publish(_ context.Context, topic, payload string) error {
+	b.topics.mu.Lock()
+	defer b.topics.mu.Unlock()
+
+	b.publish(topic, payload)
+	return nil
+}
+
+// Subscribe reads messages from `topic` as a member of the consumer group, passing each to h, until
+// ctx is canceled.
+func (b *MemoryBus) Subscribe(ctx context.Context, topic string, h Handler) error {
+	for ctx.Err() == nil {
+		msgs, published := b.fetch(topic)
+
+		for _, msg := range msgs {
+			if msg.Deliveries > b.opts.MaxDeliveries {
+				b.deadLetter(topic, msg.ID)
+				continue
+			}
+
+			if err := h(ctx, msg); err == nil {
+				b.ack(topic, msg.ID)
+			}
+		}
+
+		if len(msgs) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-published:
+		case <-time.After(b.opts.Block):
+		}
+	}
+
+	return nil
+}
+
+// publish appends a message to topic. The caller must hold the lock.
+func (b *MemoryBus) publish(topic, payload string) {
+	s := b.stream(topic)
+
+	b.topics.seq++
+	s.entries = append(s.entries, memoryEntry{
+		seq:     b.topics.seq,
+		id:      fmt.Sprintf("%d-%d", time.Now().UnixMilli(), b.topics.seq),
+		payload: payload,
+	})
+
+	if b.opts.MaxLen > 0 && int64(len(s.entries)) > b.opts.MaxLen {
+		s.entries = s.entries[int64(len(s.entries))-b.opts.MaxLen:]
+	}
+
+	close(s.published)
+	s.published = make(chan struct{})
+}
+
+// stream returns the stream of topic, creating it if needed. The caller must hold the lock.
+func (b *MemoryBus) stream(topic string) *memoryStream {
+	s, ok := b.topics.streams[topic]
+	if !ok {
+		s = &memoryStream{groups: map[string]*memoryGroup{}, published: make(chan struct{})}
+		b.topics.streams[topic] = s
+	}
+
+	return s
+}
+
+// fetch claims up to BatchSize messages for the consumer: first those left unacknowledged for the
+// visibility timeout, then new ones. The returned channel is closed when a message is next published.
+func (b *MemoryBus) fetch(topic string) ([]Message, <-chan struct{}) {
+	b.topics.mu.Lock()
+	defer b.topics.mu.Unlock()
+
+	s := b.stream(topic)
+	g, ok := s.groups[b.opts.Group]
+	if !ok {
+		g = &memoryGroup{pending: map[string]*memoryPending{}}
+		s.groups[b.opts.Group] = g
+	}
+
+	now := time.Now()
+	var claimed []*memoryPending
+	for _, p := range g.pending {
+		if now.Sub(p.delivered) >= b.opts.VisibilityTimeout {
+			claimed = append(claimed, p)
+		}
+	}
+
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].entry.seq < claimed[j].entry.seq })
+	if int64(len(claimed)) > b.opts.BatchSize {
+		claimed = claimed[:b.opts.BatchSize]
+	}
+
+	for _, e := range s.entries {
+		if int64(len(claimed)) >= b.opts.BatchSize {
+			break
+		}
+
+		if e.seq < g.next {
+			continue
+		}
+
+		p := &memoryPending{entry: e}
+		g.pending[e.id] = p
+		g.next = e.seq + 1
+		claimed = append(claimed, p)
+	}
+
+	msgs := make([]Message, len(claimed))
+	for i, p := range claimed {
+		p.delivered = now
+		p.deliveries++
+		msgs[i] = Message{ID: p.entry.id, Topic: topic, Payload: p.entry.payload, Deliveries: p.deliveries}
+	}
+
+	return msgs, s.published
+}
+
+// ack acknowledges the message at id, removing it from the pending messages of the group.
+func (b *MemoryBus) ack(topic, id string) {
+	b.topics.mu.Lock()
+	defer b.topics.mu.Unlock()
+
+	if g, ok := b.stream(topic).groups[b.opts.Group]; ok {
+		delete(g.pending, id)
+	}
+}
+
+// deadLetter moves the message at id to the dead letter topic, and acknowledges it.
+func (b *MemoryBus) deadLetter(topic, id string) {
+	b.topics.mu.Lock()
+	defer b.topics.mu.Unlock()
+
+	g, ok := b.stream(topic).groups[b.opts.Group]
+	if !ok {
+		return
+	}
+
+	if p, ok := g.pending[id]; ok {
+		delete(g.pending, id)
+		b.publish(topic+DeadLetterSuffix, p.entry.payload)
+	}
+}
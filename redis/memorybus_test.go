@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBusFetch(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus(StreamOptions{BatchSize: 2, VisibilityTimeout: 50 * time.Millisecond})
+
+	for _, payload := range []string{"one", "two", "three"} {
+		require.Nil(t, bus.Publish(ctx, "fetch", payload))
+	}
+
+	payloads := func(msgs []Message) []string {
+		var p []string
+		for _, msg := range msgs {
+			p = append(p, msg.Payload)
+		}
+		return p
+	}
+
+	// New messages are delivered in order, a batch at a time.
+	first, _ := bus.fetch("fetch")
+	require.Equal(t, []string{"one", "two"}, payloads(first))
+	require.Equal(t, 1, first[0].Deliveries)
+
+	msgs, published := bus.fetch("fetch")
+	require.Equal(t, []string{"three"}, payloads(msgs))
+
+	// Nothing is left until the visibility timeout passes, or a message is published.
+	msgs, _ = bus.fetch("fetch")
+	require.Empty(t, msgs)
+
+	require.Nil(t, bus.Publish(ctx, "fetch", "four"))
+	select {
+	case <-published:
+	default:
+		require.FailNow(t, "publish not signaled")
+	}
+
+	// Unacknowledged messages are claimed again, oldest first, ahead of new ones.
+	bus.ack("fetch", first[0].ID)
+	time.Sleep(60 * time.Millisecond)
+
+	msgs, _ = bus.fetch("fetch")
+	require.Equal(t, []string{"two", "three"}, payloads(msgs))
+	require.Equal(t, 2, msgs[0].Deliveries)
+
+	msgs, _ = bus.fetch("fetch")
+	require.Equal(t, []string{"four"}, payloads(msgs))
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	"github.com/btm6084/utilities/metrics"
@@ -8,7 +9,13 @@ import (
 
 var (
 	// Compiler will enforce the interface and let us know if the contract is broken.
-	_ Cache = (*Noop)(nil)
+	_ Batcher      = (*Noop)(nil)
+	_ Cache        = (*Noop)(nil)
+	_ ContextCache = (*Noop)(nil)
+	_ Locker       = (*Noop)(nil)
+	_ RateLimiter  = (*Noop)(nil)
+	_ PubSub       = (*Noop)(nil)
+	_ Tagger       = (*Noop)(nil)
 )
 
 // Noop allows us to have a passthrough, do nothing cache.
@@ -28,6 +35,78 @@ func (n *Noop) IncrementHashWithDuration(metrics.Recorder, string, string, int,
 func (n *Noop) GetHashSet(metrics.Recorder, []string) ([]map[string]string, error) {
 	return nil, ErrNotFound
 }
+func (n *Noop) Increment(metrics.Recorder, string, int64, time.Duration) (int64, error) {
+	return 0, nil
+}
+func (n *Noop) IncrementFloat(metrics.Recorder, string, float64, time.Duration) (float64, error) {
+	return 0, nil
+}
+func (n *Noop) GetHash(metrics.Recorder, string) (map[string]string, error) { return nil, ErrNotFound }
+func (n *Noop) SetHashFields(metrics.Recorder, string, map[string]interface{}, time.Duration) error {
+	return nil
+}
+func (n *Noop) DeleteHashFields(metrics.Recorder, string, ...string) error { return nil }
 func (n *Noop) SetWithDuration(metrics.Recorder, string, interface{}, time.Duration) error {
 	return nil
 }
+func (n *Noop) GetStringContext(context.Context, string) (string, error)  { return "", ErrNotFound }
+func (n *Noop) GetContext(context.Context, string) (interface{}, error)   { return nil, ErrNotFound }
+func (n *Noop) TTLContext(context.Context, string) (time.Duration, error) { return 0, nil }
+func (n *Noop) SetContext(context.Context, string, interface{}) error     { return nil }
+func (n *Noop) SetWithDurationContext(context.Context, string, interface{}, time.Duration) error {
+	return nil
+}
+func (n *Noop) DeleteContext(context.Context, string) error { return nil }
+func (n *Noop) SetWithTags(metrics.Recorder, string, interface{}, time.Duration, ...string) error {
+	return nil
+}
+func (n *Noop) SetMany(metrics.Recorder, map[string]interface{}, time.Duration) error { return nil }
+func (n *Noop) DeleteMany(metrics.Recorder, []string) error                           { return nil }
+func (n *Noop) InvalidateTag(metrics.Recorder, string) error                          { return nil }
+func (n *Noop) DeletePrefix(metrics.Recorder, string) error                           { return nil }
+func (n *Noop) Publish(metrics.Recorder, string, string) error                        { return nil }
+
+// Subscribe returns a channel that receives no messages, and is closed once ctx is canceled.
+func (n *Noop) Subscribe(ctx context.Context, _ string) (<-chan string, error) {
+	out := make(chan string)
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// GetMany reports every key as not found.
+func (n *Noop) GetMany(_ metrics.Recorder, keys []string) (map[string]interface{}, map[string]error) {
+	errs := make(map[string]error, len(keys))
+	for _, key := range keys {
+		errs[key] = ErrNotFound
+	}
+
+	return map[string]interface{}{}, errs
+}
+
+// Lock always succeeds, as there is nothing to contend over.
+func (n *Noop) Lock(context.Context, string, time.Duration) (Lock, error) { return noopLock{}, nil }
+
+// TryLock always succeeds, as there is nothing to contend over.
+func (n *Noop) TryLock(context.Context, string, time.Duration) (Lock, error) {
+	return noopLock{}, nil
+}
+
+// noopLock is a Lock that's never lost.
+type noopLock struct{}
+
+func (noopLock) Refresh(context.Context, time.Duration) error { return nil }
+func (noopLock) Unlock(context.Context) error                 { return nil }
+
+// SlidingWindow allows every request.
+func (n *Noop) SlidingWindow(_ context.Context, _ string, limit int, _ time.Duration) (RateLimit, error) {
+	return RateLimit{Allowed: true, Limit: limit, Remaining: limit}, nil
+}
+
+// TokenBucket allows every request.
+func (n *Noop) TokenBucket(_ context.Context, _ string, capacity int, _ time.Duration) (RateLimit, error) {
+	return RateLimit{Allowed: true, Limit: capacity, Remaining: capacity}, nil
+}
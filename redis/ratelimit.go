@@ -0,0 +1,173 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ RateLimiter = (*Client)(nil)
+
+	// slidingWindow admits a request if fewer than limit were admitted within the window, recording
+	// each admitted request in a sorted set scored by its time.
+	//
+	// KEYS[1] is the set. ARGV[1] is the time in ms, ARGV[2] the window in ms, ARGV[3] the limit, and
+	// ARGV[4] a unique member for the request. Returns allowed, remaining, retry after and reset, in ms.
+	slidingWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if #oldest > 0 then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+local retry = 0
+if allowed == 0 then
+	retry = reset
+end
+
+return {allowed, limit - count, retry, reset}
+`)
+
+	// tokenBucket admits a request if a token is available, from a bucket of capacity tokens that
+	// regains a token every interval. The bucket is a hash of its tokens and the time they were counted.
+	//
+	// KEYS[1] is the bucket. ARGV[1] is the time in ms, ARGV[2] the interval in ms, and ARGV[3] the
+	// capacity. Returns allowed, remaining, retry after and reset, in ms.
+	tokenBucket = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+local refill = math.floor((now - ts) / interval)
+if refill > 0 then
+	tokens = math.min(capacity, tokens + refill)
+	ts = ts + refill * interval
+end
+if tokens >= capacity then
+	ts = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = interval - (now - ts)
+end
+
+local reset = 0
+if tokens < capacity then
+	reset = (capacity - tokens) * interval - (now - ts)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], capacity * interval)
+
+return {allowed, tokens, retry, reset}
+`)
+)
+
+// RateLimit is the outcome of checking a request against a rate limit.
+type RateLimit struct {
+	// Allowed reports whether the request is within the limit.
+	Allowed bool
+
+	// Limit is the most requests allowed at once, and Remaining how many more are allowed now.
+	Limit     int
+	Remaining int
+
+	// RetryAfter is how long until a request will be allowed, when this one wasn't.
+	RetryAfter time.Duration
+
+	// Reset is how long until the full limit is available again.
+	Reset time.Duration
+}
+
+// RateLimiter counts requests against rate limits shared across processes. Times are taken from
+// the clock of the calling process, so processes sharing a limit should keep their clocks in sync.
+type RateLimiter interface {
+	SlidingWindow(context.Context, string, int, time.Duration) (RateLimit, error)
+	TokenBucket(context.Context, string, int, time.Duration) (RateLimit, error)
+}
+
+// SlidingWindow admits a request at `key` if fewer than limit requests were admitted within the
+// preceding window.
+func (c *Client) SlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (RateLimit, error) {
+	member, err := lockToken()
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "EVALSHA ZADD")
+	defer r.DatabaseSegment("redis", "sliding window rate limit", limit, window)()
+	res, err := slidingWindow.Run(ctx, c.RDB, []string{key}, time.Now().UnixMilli(), window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	return rateLimit(limit, res), nil
+}
+
+// TokenBucket admits a request at `key` if a token is available from a bucket holding up to
+// capacity tokens, which regains a token every interval.
+func (c *Client) TokenBucket(ctx context.Context, key string, capacity int, interval time.Duration) (RateLimit, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "EVALSHA HSET")
+	defer r.DatabaseSegment("redis", "token bucket rate limit", capacity, interval)()
+	res, err := tokenBucket.Run(ctx, c.RDB, []string{key}, time.Now().UnixMilli(), interval.Milliseconds(), capacity).Int64Slice()
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	return rateLimit(capacity, res), nil
+}
+
+// rateLimit reads the allowed, remaining, retry after and reset values returned by a rate limit script.
+func rateLimit(limit int, res []int64) RateLimit {
+	return RateLimit{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+		Reset:      time.Duration(res[3]) * time.Millisecond,
+	}
+}
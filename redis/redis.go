@@ -3,6 +3,7 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"strings"
 	"time"
@@ -16,14 +17,21 @@ var (
 	// DefaultTTL defines a default TTL value for all keys.
 	DefaultTTL time.Duration
 
-	// Namespace allows for a custom Namespace to be added to all keys.
+	// Namespace allows for a custom Namespace to be added to all keys of Clients created without one.
+	//
+	// Deprecated: set ClientOptions.Namespace, or use Client.WithNamespace, instead.
 	Namespace = ""
 
+	// DefaultRequestTimeout bounds each call made by a Client created without a RequestTimeout.
+	DefaultRequestTimeout = 5 * time.Second
+
 	// ErrNotFound is returned when no data was found
 	ErrNotFound = errors.New("not found")
 
 	// Compiler will enforce the interface and let us know if the contract is broken.
-	_ Cache = (*Client)(nil)
+	_ Cache        = (*Client)(nil)
+	_ ContextCache = (*Client)(nil)
+	_ PubSub       = (*Client)(nil)
 )
 
 func init() {
@@ -31,23 +39,133 @@ func init() {
 	DefaultTTL = 5 * time.Minute
 }
 
-// Client provides interaction with redis.
+// Client provides interaction with redis. RDB is a *redis.Client, or when created by NewFailover or
+// NewCluster, a failover *redis.Client or *redis.ClusterClient.
 type Client struct {
-	RDB            *redis.Client
+	RDB            redis.UniversalClient
 	requestTimeout time.Duration
+	breaker        *Breaker
+
+	// namespace is used in place of the package Namespace once hasNamespace is set, even if empty.
+	namespace    string
+	hasNamespace bool
+}
+
+// ClientOptions configures a Client. Zero values take the go-redis defaults.
+type ClientOptions struct {
+	// Addr is the host:port of the redis server.
+	Addr string
+
+	// Namespace is prepended to every key used by the Client. Defaults to the package Namespace. Use
+	// Client.WithNamespace("") for a Client without a namespace, regardless of the package Namespace.
+	Namespace string
+
+	// ClientName is set on each connection with CLIENT SETNAME.
+	ClientName string
+
+	// Username and Password authenticate each connection. Username selects an ACL user, and may
+	// be left empty to authenticate with Password alone.
+	Username string
+	Password string
+
+	// DB is the index of the database selected on each connection.
+	DB int
+
+	// TLSConfig, if set, connects to the server over TLS.
+	TLSConfig *tls.Config
+
+	// PoolSize is the most connections held open. MinIdleConns is the fewest idle connections kept open.
+	PoolSize     int
+	MinIdleConns int
+
+	// RequestTimeout bounds each call made by the Client, including any retries. Defaults to DefaultRequestTimeout.
+	RequestTimeout time.Duration
+
+	// DialTimeout, ReadTimeout and WriteTimeout bound individual network operations.
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// MaxRetries is how many times a failed command is retried; -1 disables retries. Retries back off
+	// between MinRetryBackoff and MaxRetryBackoff.
+	MaxRetries      int
+	MinRetryBackoff time.Duration
+	MaxRetryBackoff time.Duration
+
+	// Breaker, if set, installs a circuit breaker on the Client. See Breaker.
+	Breaker *BreakerOptions
 }
 
 // New creates a new client.
 func New(server string, requestTimeout time.Duration, clientName string) *Client {
-	return &Client{
-		RDB: redis.NewClient(&redis.Options{
-			Addr:      server,
-			Password:  "", // no password set
-			DB:        0,  // use default DB
-			OnConnect: onConnect(clientName),
-		}),
-		requestTimeout: requestTimeout,
+	return NewWithOptions(ClientOptions{
+		Addr:           server,
+		ClientName:     clientName,
+		RequestTimeout: requestTimeout,
+	})
+}
+
+// NewWithOptions creates a new client configured by opts.
+func NewWithOptions(opts ClientOptions) *Client {
+	return newClient(opts, redis.NewClient(&redis.Options{
+		Addr:            opts.Addr,
+		Username:        opts.Username,
+		Password:        opts.Password,
+		DB:              opts.DB,
+		TLSConfig:       opts.TLSConfig,
+		PoolSize:        opts.PoolSize,
+		MinIdleConns:    opts.MinIdleConns,
+		DialTimeout:     opts.DialTimeout,
+		ReadTimeout:     opts.ReadTimeout,
+		WriteTimeout:    opts.WriteTimeout,
+		MaxRetries:      opts.MaxRetries,
+		MinRetryBackoff: opts.MinRetryBackoff,
+		MaxRetryBackoff: opts.MaxRetryBackoff,
+		OnConnect:       onConnect(opts.ClientName),
+	}))
+}
+
+// newClient wraps rdb, which was configured by opts.
+func newClient(opts ClientOptions, rdb redis.UniversalClient) *Client {
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = DefaultRequestTimeout
+	}
+
+	c := &Client{RDB: rdb, requestTimeout: opts.RequestTimeout, namespace: opts.Namespace, hasNamespace: opts.Namespace != ""}
+	if opts.Breaker != nil {
+		c.breaker = NewBreaker(*opts.Breaker)
+		rdb.AddHook(c.breaker)
 	}
+
+	return c
+}
+
+// Breaker returns the circuit breaker of the Client, or nil if it has none.
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// WithNamespace returns a Client sharing the connections of c, which prepends ns to every key. An
+// empty ns leaves keys unprefixed, regardless of the package Namespace.
+func (c *Client) WithNamespace(ns string) *Client {
+	nc := *c
+	nc.namespace = ns
+	nc.hasNamespace = true
+	return &nc
+}
+
+// Namespace returns the prefix prepended to every key used by the Client.
+func (c *Client) Namespace() string {
+	if !c.hasNamespace {
+		return Namespace
+	}
+
+	return c.namespace
+}
+
+// key returns key within the namespace of the Client.
+func (c *Client) key(key string) string {
+	return c.Namespace() + key
 }
 
 func onConnect(clientName string) func(context.Context, *redis.Conn) error {
@@ -84,11 +202,18 @@ func (c *Client) Ping(r metrics.Recorder) error {
 	return nil
 }
 
+// GetString returns the value at `key` as a string.
 func (c *Client) GetString(r metrics.Recorder, key string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	return c.GetStringContext(metrics.ContextWithRecorder(context.Background(), r), key)
+}
+
+// GetStringContext returns the value at `key` as a string. The request is abandoned if ctx is canceled.
+func (c *Client) GetStringContext(ctx context.Context, key string) (string, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
-	key = Namespace + key
+	key = c.key(key)
 
 	r.SetDBMeta("Redis", key, "GET")
 	defer r.DatabaseSegment("redis", "get key")()
@@ -97,7 +222,7 @@ func (c *Client) GetString(r metrics.Recorder, key string) (string, error) {
 		if rsp.Err() == redis.Nil {
 			return "", ErrNotFound
 		}
-		return "", rsp.Err()
+		return "", readErr(rsp.Err())
 	}
 
 	return rsp.Val(), nil
@@ -108,18 +233,29 @@ func (c *Client) Get(r metrics.Recorder, key string) (interface{}, error) {
 	return c.GetString(r, key)
 }
 
+// GetContext returns the value at `key`. The request is abandoned if ctx is canceled.
+func (c *Client) GetContext(ctx context.Context, key string) (interface{}, error) {
+	return c.GetStringContext(ctx, key)
+}
+
 // TTL returns the TTL for the value at `key`
 func (c *Client) TTL(r metrics.Recorder, key string) (time.Duration, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	return c.TTLContext(metrics.ContextWithRecorder(context.Background(), r), key)
+}
+
+// TTLContext returns the TTL for the value at `key`. The request is abandoned if ctx is canceled.
+func (c *Client) TTLContext(ctx context.Context, key string) (time.Duration, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
-	key = Namespace + key
+	key = c.key(key)
 
 	r.SetDBMeta("Redis", key, "TTL")
 	defer r.DatabaseSegment("redis", "get ttl")()
 	rsp := c.RDB.TTL(ctx, key)
 	if rsp.Err() != nil {
-		return 1 * time.Microsecond, rsp.Err()
+		return 1 * time.Microsecond, readErr(rsp.Err())
 	}
 
 	return rsp.Val(), nil
@@ -130,35 +266,78 @@ func (c *Client) Set(r metrics.Recorder, key string, value interface{}) error {
 	return c.SetWithDuration(r, key, value, DefaultTTL)
 }
 
+// SetContext stores the value at `key` with the default TTL. The request is abandoned if ctx is canceled.
+func (c *Client) SetContext(ctx context.Context, key string, value interface{}) error {
+	return c.SetWithDurationContext(ctx, key, value, DefaultTTL)
+}
+
 // SetWithDuration stores the value at `key` with the provided TTL.
 func (c *Client) SetWithDuration(r metrics.Recorder, key string, value interface{}, ttl time.Duration) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	return c.SetWithDurationContext(metrics.ContextWithRecorder(context.Background(), r), key, value, ttl)
+}
+
+// SetWithDurationContext stores the value at `key` with the provided TTL. The request is abandoned if
+// ctx is canceled.
+func (c *Client) SetWithDurationContext(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
-	key = Namespace + key
+	key = c.key(key)
 
 	r.SetDBMeta("Redis", key, "SET")
 	defer r.DatabaseSegment("redis", "set with duration", value, ttl)()
 	rsp := c.RDB.Set(ctx, key, value, ttl)
 	if rsp.Err() != nil && rsp.Err() != redis.Nil {
-		return rsp.Err()
+		return writeErr(rsp.Err())
 	}
 
 	return nil
 }
 
+// SetNX stores the value at `key` with the provided TTL only if `key` does not already exist.
+// Returns true if the value was stored.
+func (c *Client) SetNX(r metrics.Recorder, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return c.SetNXContext(metrics.ContextWithRecorder(context.Background(), r), key, value, ttl)
+}
+
+// SetNXContext stores the value at `key` with the provided TTL only if `key` does not already exist.
+// Returns true if the value was stored. The request is abandoned if ctx is canceled.
+func (c *Client) SetNXContext(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "SETNX")
+	defer r.DatabaseSegment("redis", "set if not exists", value, ttl)()
+	rsp := c.RDB.SetNX(ctx, key, value, ttl)
+	if rsp.Err() != nil && rsp.Err() != redis.Nil {
+		return false, writeErr(rsp.Err())
+	}
+
+	return rsp.Val(), nil
+}
+
 // Delete removes the value at `key`
 func (c *Client) Delete(r metrics.Recorder, key string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	return c.DeleteContext(metrics.ContextWithRecorder(context.Background(), r), key)
+}
+
+// DeleteContext removes the value at `key`. The request is abandoned if ctx is canceled.
+func (c *Client) DeleteContext(ctx context.Context, key string) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
-	key = Namespace + key
+	key = c.key(key)
 
 	r.SetDBMeta("Redis", key, "DEL")
 	defer r.DatabaseSegment("redis", "del key")()
 	rsp := c.RDB.Del(ctx, key)
 	if rsp.Err() != nil && rsp.Err() != redis.Nil {
-		return rsp.Err()
+		return writeErr(rsp.Err())
 	}
 
 	return nil
@@ -171,39 +350,26 @@ func (c *Client) IncrementHash(r metrics.Recorder, key, field string, amount int
 
 // IncrementHashWithDuration increments a value at a give key/field location.
 //
-// We can only expire the entire hash. We set a TTL via Expire once only if the hash key has not
-// previously existed. We make the assumption that if it already exists, it's already had an Expire set.
+// We can only expire the entire hash. The increment and expiry are applied atomically, and the TTL is
+// only set if the hash has none, so that it expires ttl after it was created. A ttl <= 0 sets no expiry.
 func (c *Client) IncrementHashWithDuration(r metrics.Recorder, key, field string, amount int, ttl time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
 	defer cancel()
 
-	key = Namespace + key
+	key = c.key(key)
 
-	expire := false
-	end := r.DatabaseSegment("redis", "exists", key)
-	if c.RDB.Exists(ctx, key).Val() == 0 {
-		expire = true
-	}
-	end()
-
-	r.SetDBMeta("Redis", key, "HINCRBY")
-	end = r.DatabaseSegment("redis", "hash increment at key.field", field, amount)
-	rsp := c.RDB.HIncrBy(ctx, key, field, int64(amount))
-	end()
-	if rsp.Err() != nil && rsp.Err() != redis.Nil {
-		return rsp.Err()
-	}
-
-	if expire {
-		end = r.DatabaseSegment("redis", "expire", key)
-		c.RDB.Expire(ctx, key, ttl)
-		end()
+	r.SetDBMeta("Redis", key, "EVALSHA HINCRBY")
+	defer r.DatabaseSegment("redis", "hash increment at key.field", field, amount)()
+	err := incrementHash.Run(ctx, c.RDB, []string{key}, field, amount, ttl.Milliseconds()).Err()
+	if err != nil && err != redis.Nil {
+		return writeErr(err)
 	}
 
 	return nil
 }
 
 // GetHashSet uses a redis pipe to retrieve a number of hashes and return an aggregate of their responses.
+// In cluster mode, a pipe is sent for each hash slot holding the keys.
 func (c *Client) GetHashSet(r metrics.Recorder, keys []string) ([]map[string]string, error) {
 	if len(keys) == 0 {
 		return nil, ErrNotFound
@@ -214,18 +380,21 @@ func (c *Client) GetHashSet(r metrics.Recorder, keys []string) ([]map[string]str
 	r.SetDBMeta("Redis", strings.Join(keys, ","), "HGETALL PIPE "+cast.ToString(len(keys)))
 	defer r.DatabaseSegment("redis", "get hash set")()
 
-	pipe := c.RDB.TxPipeline()
-
-	var vals []*redis.StringStringMapCmd
-
-	for _, key := range keys {
-		key = Namespace + key
-		vals = append(vals, pipe.HGetAll(ctx, key))
+	namespaced := make([]string, len(keys))
+	for i, key := range keys {
+		namespaced[i] = c.key(key)
 	}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return nil, err
+	vals := make([]*redis.StringStringMapCmd, len(keys))
+	for _, group := range c.slotGroups(namespaced) {
+		pipe := c.RDB.TxPipeline()
+		for _, i := range group {
+			vals[i] = pipe.HGetAll(ctx, namespaced[i])
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, readErr(err)
+		}
 	}
 
 	var result []map[string]string
@@ -236,3 +405,135 @@ func (c *Client) GetHashSet(r metrics.Recorder, keys []string) ([]map[string]str
 
 	return result, nil
 }
+
+// GetHash returns every field of the hash at `key`.
+func (c *Client) GetHash(r metrics.Recorder, key string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "HGETALL")
+	defer r.DatabaseSegment("redis", "get hash")()
+	rsp := c.RDB.HGetAll(ctx, key)
+	if rsp.Err() != nil {
+		return nil, readErr(rsp.Err())
+	}
+
+	if len(rsp.Val()) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return rsp.Val(), nil
+}
+
+// SetHashFields stores fields in the hash at `key`, leaving its other fields in place. The whole hash
+// expires after the provided TTL, or never if ttl <= 0.
+func (c *Client) SetHashFields(r metrics.Recorder, key string, fields map[string]interface{}, ttl time.Duration) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "HSET")
+	defer r.DatabaseSegment("redis", "set hash fields", len(fields), ttl)()
+
+	pipe := c.RDB.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	if ttl > 0 {
+		pipe.PExpire(ctx, key, ttl)
+	} else {
+		pipe.Persist(ctx, key)
+	}
+
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return writeErr(err)
+	}
+
+	return nil
+}
+
+// DeleteHashFields removes fields from the hash at `key`.
+func (c *Client) DeleteHashFields(r metrics.Recorder, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	key = c.key(key)
+
+	r.SetDBMeta("Redis", key, "HDEL")
+	defer r.DatabaseSegment("redis", "delete hash fields", fields)()
+	rsp := c.RDB.HDel(ctx, key, fields...)
+	if rsp.Err() != nil && rsp.Err() != redis.Nil {
+		return writeErr(rsp.Err())
+	}
+
+	return nil
+}
+
+// Publish sends message to all subscribers of `channel`. Returns ErrCircuitOpen while the circuit
+// breaker is open, as the message is lost rather than skipped like a cache write.
+func (c *Client) Publish(r metrics.Recorder, channel, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	channel = c.key(channel)
+
+	r.SetDBMeta("Redis", channel, "PUBLISH")
+	defer r.DatabaseSegment("redis", "publish")()
+	rsp := c.RDB.Publish(ctx, channel, message)
+	if rsp.Err() != nil && rsp.Err() != redis.Nil {
+		return rsp.Err()
+	}
+
+	return nil
+}
+
+// Subscribe listens for messages published to `channel`. Messages are delivered on the returned
+// channel until ctx is canceled, at which point the subscription ends and the channel is closed.
+func (c *Client) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	ps := c.RDB.Subscribe(ctx, c.key(channel))
+
+	// Wait for confirmation that the subscription is active before returning.
+	rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	if _, err := ps.Receive(rctx); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer ps.Close()
+
+		msgs := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				select {
+				case out <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
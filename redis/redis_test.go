@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptions(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("cache", "secret")
+
+	t.Run("Authenticates And Selects DB", func(t *testing.T) {
+		rdb := NewWithOptions(ClientOptions{
+			Addr:       mr.Addr(),
+			ClientName: "options_test",
+			Username:   "cache",
+			Password:   "secret",
+			DB:         3,
+			PoolSize:   2,
+		})
+		defer rdb.RDB.Close()
+
+		require.Nil(t, rdb.Ping(m))
+		require.Nil(t, rdb.Set(m, "options", "value"))
+		stored, err := mr.DB(3).Get("options")
+		require.Nil(t, err)
+		require.Equal(t, "value", stored)
+
+		name, err := rdb.RDB.ClientGetName(context.Background()).Result()
+		require.Nil(t, err)
+		require.Equal(t, "options_test", name)
+	})
+
+	t.Run("Rejects Bad Credentials", func(t *testing.T) {
+		rdb := NewWithOptions(ClientOptions{
+			Addr:       mr.Addr(),
+			Username:   "cache",
+			Password:   "wrong",
+			MaxRetries: -1,
+		})
+		defer rdb.RDB.Close()
+
+		require.NotNil(t, rdb.Ping(m))
+	})
+
+	t.Run("Default Request Timeout", func(t *testing.T) {
+		rdb := NewWithOptions(ClientOptions{Addr: mr.Addr(), Username: "cache", Password: "secret"})
+		defer rdb.RDB.Close()
+
+		require.Nil(t, rdb.Ping(m))
+	})
+}
@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNoNamespace is returned by PurgeNamespace for a Client without a namespace, as every key in the
+// database would be purged.
+var ErrNoNamespace = errors.New("client has no namespace")
+
+// KeyIterator steps through the keys found by Scan, without the namespace of the Client. As with
+// SCAN, a key may be returned more than once, and keys written during the scan may be missed.
+type KeyIterator struct {
+	ctx   context.Context
+	c     *Client
+	match string
+
+	// nodes are left to scan, starting with the node at cursor. started reports whether the current
+	// node has been scanned from, so that a zero cursor marks its end.
+	nodes   []redis.Cmdable
+	cursor  uint64
+	started bool
+
+	keys []string
+	key  string
+	err  error
+}
+
+// Scan returns an iterator over the keys in the namespace of the Client matching the SCAN pattern,
+// e.g. "user:*". An empty pattern matches every key. Keys are found with SCAN, never KEYS, so
+// large namespaces don't block the server. If the circuit breaker of the Client is open, the iterator
+// stops with ErrCircuitOpen, rather than returning no keys as though the namespace were empty.
+func (c *Client) Scan(ctx context.Context, pattern string) *KeyIterator {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	it := &KeyIterator{ctx: ctx, c: c, match: escapePattern(c.Namespace()) + pattern}
+
+	// Each node of a cluster holds its own keys, and must be scanned separately.
+	cc, ok := c.RDB.(*redis.ClusterClient)
+	if !ok {
+		it.nodes = []redis.Cmdable{c.RDB}
+		return it
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	it.err = cc.ForEachMaster(tctx, func(_ context.Context, node *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		it.nodes = append(it.nodes, node)
+		return nil
+	})
+
+	return it
+}
+
+// Next advances to the next key, returning false once there are no more keys or an error occurred.
+func (it *KeyIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.err != nil || len(it.nodes) == 0 {
+			return false
+		}
+
+		if it.started && it.cursor == 0 {
+			it.nodes = it.nodes[1:]
+			it.started = false
+			continue
+		}
+
+		it.scan()
+	}
+
+	it.key, it.keys = it.keys[0], it.keys[1:]
+	return true
+}
+
+// Key returns the current key, without the namespace of the Client.
+func (it *KeyIterator) Key() string {
+	return strings.TrimPrefix(it.key, it.c.Namespace())
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// scan reads the next page of keys from the current node.
+func (it *KeyIterator) scan() {
+	r := metrics.GetRecorder(it.ctx)
+	ctx, cancel := context.WithTimeout(it.ctx, it.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", it.match, "SCAN")
+	defer r.DatabaseSegment("redis", "scan", it.cursor)()
+	it.keys, it.cursor, it.err = it.nodes[0].Scan(ctx, it.cursor, it.match, scanBatchSize).Result()
+	it.started = true
+}
+
+// PurgeOptions configures PurgeNamespace.
+type PurgeOptions struct {
+	// Pattern limits the purge to keys matching the SCAN pattern. Defaults to every key.
+	Pattern string
+
+	// DryRun counts the keys that would be removed, without removing them.
+	DryRun bool
+
+	// BatchSize is how many keys are removed by each DEL. Defaults to 500.
+	BatchSize int
+}
+
+// PurgeNamespace removes the keys in the namespace of the Client matching opts.Pattern, returning how
+// many were found. The count is approximate, as SCAN may return a key more than once. Returns
+// ErrNoNamespace if the Client has no namespace.
+func (c *Client) PurgeNamespace(ctx context.Context, opts PurgeOptions) (int, error) {
+	if c.Namespace() == "" {
+		return 0, ErrNoNamespace
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = int(scanBatchSize)
+	}
+
+	count := 0
+	batch := make([]string, 0, opts.BatchSize)
+	flush := func() error {
+		if opts.DryRun || len(batch) == 0 {
+			batch = batch[:0]
+			return nil
+		}
+
+		r := metrics.GetRecorder(ctx)
+		dctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+
+		r.SetDBMeta("Redis", c.Namespace(), "DEL")
+		defer r.DatabaseSegment("redis", "purge namespace", len(batch))()
+		err := c.del(dctx, c.RDB, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	it := c.Scan(ctx, opts.Pattern)
+	for it.Next() {
+		count++
+		batch = append(batch, c.key(it.Key()))
+
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return count, err
+	}
+
+	return count, flush()
+}
+
+// KeyInfo describes a stored key.
+type KeyInfo struct {
+	// Key is the name of the key, without the namespace of the Client.
+	Key string
+
+	// Type is the Redis type of the value, e.g. "string" or "hash".
+	Type string
+
+	// Size is the memory used by the key and its value, in bytes, as reported by MEMORY USAGE.
+	Size int64
+
+	// TTL is the time until the key expires, or 0 if it never expires.
+	TTL time.Duration
+}
+
+// KeyInfo returns the type, size and TTL of each key, skipping keys that don't exist.
+func (c *Client) KeyInfo(ctx context.Context, keys ...string) ([]KeyInfo, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", c.key(keys[0]), "TYPE MEMORY PTTL")
+	defer r.DatabaseSegment("redis", "key info", len(keys))()
+
+	types := make([]*redis.StatusCmd, len(keys))
+	sizes := make([]*redis.IntCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+
+	pipe := c.RDB.Pipeline()
+	for i, key := range keys {
+		types[i] = pipe.Type(ctx, c.key(key))
+
+		// Sent as MEMORY USAGE, in upper case, as some Redis compatible servers only accept that.
+		// The key position is set so that cluster clients route the command by its key.
+		sizes[i] = redis.NewIntCmd(ctx, "MEMORY", "USAGE", c.key(key))
+		sizes[i].SetFirstKeyPos(2)
+		pipe.Process(ctx, sizes[i])
+
+		ttls[i] = pipe.PTTL(ctx, c.key(key))
+	}
+
+	// MEMORY USAGE replies nil for keys that don't exist, which are skipped below.
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var info []KeyInfo
+	for i, key := range keys {
+		if types[i].Val() == "none" || types[i].Err() != nil {
+			continue
+		}
+
+		ttl := ttls[i].Val()
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		info = append(info, KeyInfo{Key: key, Type: types[i].Val(), Size: sizes[i].Val(), TTL: ttl})
+	}
+
+	return info, nil
+}
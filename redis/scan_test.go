@@ -0,0 +1,148 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaces(t *testing.T) {
+	m := &metrics.NoOp{}
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	a := NewWithOptions(ClientOptions{Addr: mr.Addr(), Namespace: "a:"})
+	b := a.WithNamespace("b:")
+	require.Equal(t, "a:", a.Namespace())
+	require.Equal(t, "b:", b.Namespace())
+
+	scan := func(t *testing.T, c *Client, pattern string) []string {
+		var keys []string
+		it := c.Scan(ctx, pattern)
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+
+		require.Nil(t, it.Err())
+		sort.Strings(keys)
+		return keys
+	}
+
+	t.Run("Clients Don't Share Keys", func(t *testing.T) {
+		require.Nil(t, a.Set(m, "shared", "from a"))
+		require.Nil(t, b.Set(m, "shared", "from b"))
+
+		val, err := a.Get(m, "shared")
+		require.Nil(t, err)
+		require.Equal(t, "from a", val)
+
+		val, err = b.Get(m, "shared")
+		require.Nil(t, err)
+		require.Equal(t, "from b", val)
+
+		require.True(t, mr.Exists("a:shared"))
+		require.True(t, mr.Exists("b:shared"))
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		// More keys than are returned by a single SCAN.
+		s := a.WithNamespace("scan:")
+		for i := 0; i < 1200; i++ {
+			require.Nil(t, s.Set(m, "user:"+strconv.Itoa(i), "value"))
+		}
+		require.Nil(t, s.Set(m, "other", "value"))
+
+		keys := scan(t, s, "user:*")
+		require.Len(t, keys, 1200)
+		require.Contains(t, keys, "user:0")
+		require.Len(t, scan(t, s, ""), 1201)
+		require.Equal(t, []string{"shared"}, scan(t, b, ""))
+
+		n, err := s.PurgeNamespace(ctx, PurgeOptions{Pattern: "user:*", DryRun: true})
+		require.Nil(t, err)
+		require.Equal(t, 1200, n)
+		require.True(t, mr.Exists("scan:user:0"))
+	})
+
+	t.Run("Purge Namespace", func(t *testing.T) {
+		for i := 0; i < 300; i++ {
+			require.Nil(t, a.Set(m, "user:"+strconv.Itoa(i), "value"))
+		}
+		require.Nil(t, a.Set(m, "other", "value"))
+		require.Nil(t, b.Set(m, "user:1", "value"))
+
+		n, err := a.PurgeNamespace(ctx, PurgeOptions{Pattern: "user:1*", BatchSize: 7})
+		require.Nil(t, err)
+		require.Equal(t, 111, n)
+		require.Len(t, scan(t, a, "user:*"), 189)
+		require.False(t, mr.Exists("a:user:1"))
+
+		n, err = a.PurgeNamespace(ctx, PurgeOptions{})
+		require.Nil(t, err)
+		require.Equal(t, 191, n)
+		require.Empty(t, scan(t, a, ""))
+		require.Equal(t, []string{"shared", "user:1"}, scan(t, b, ""))
+
+		_, err = b.WithNamespace("").PurgeNamespace(ctx, PurgeOptions{})
+		require.Equal(t, ErrNoNamespace, err)
+		require.True(t, mr.Exists("b:shared"))
+	})
+
+	t.Run("Opting Out Of The Package Namespace", func(t *testing.T) {
+		Namespace = "global:"
+		defer func() { Namespace = "" }()
+
+		global := NewWithOptions(ClientOptions{Addr: mr.Addr()})
+		defer global.RDB.Close()
+		require.Equal(t, "global:", global.Namespace())
+
+		none := global.WithNamespace("")
+		require.Equal(t, "", none.Namespace())
+		require.Nil(t, none.Set(m, "unprefixed", "value"))
+		require.True(t, mr.Exists("unprefixed"))
+
+		_, err := none.PurgeNamespace(ctx, PurgeOptions{})
+		require.Equal(t, ErrNoNamespace, err)
+		require.True(t, mr.Exists("unprefixed"))
+
+		// Clients with their own namespace ignore the package Namespace.
+		require.Equal(t, "a:", a.Namespace())
+	})
+
+	t.Run("Key Info", func(t *testing.T) {
+		require.Nil(t, b.SetWithDuration(m, "expiring", "value", time.Minute))
+		require.Nil(t, b.SetWithDuration(m, "forever", "value", 0))
+		require.Nil(t, b.IncrementHash(m, "hash", "count", 1))
+
+		info, err := b.KeyInfo(ctx, "expiring", "forever", "hash", "missing")
+		require.Nil(t, err)
+		require.Len(t, info, 3)
+
+		require.Equal(t, "expiring", info[0].Key)
+		require.Equal(t, "string", info[0].Type)
+		require.Equal(t, time.Minute, info[0].TTL)
+		require.Greater(t, info[0].Size, int64(0))
+
+		require.Equal(t, time.Duration(0), info[1].TTL)
+		require.Equal(t, "hash", info[2].Type)
+	})
+
+	t.Run("Cluster Scan", func(t *testing.T) {
+		rdb := NewCluster(ClusterOptions{ClientOptions: ClientOptions{Namespace: "c:"}, Addrs: []string{mr.Addr()}})
+		defer rdb.RDB.Close()
+
+		require.Nil(t, rdb.SetMany(m, map[string]interface{}{"foo": "1", "bar": "2"}, time.Minute))
+		require.Equal(t, []string{"bar", "foo"}, scan(t, rdb, ""))
+
+		n, err := rdb.PurgeNamespace(ctx, PurgeOptions{})
+		require.Nil(t, err)
+		require.Equal(t, 2, n)
+		require.False(t, mr.Exists("c:foo"))
+	})
+}
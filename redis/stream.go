@@ -0,0 +1,396 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// DeadLetterSuffix is appended to a topic to name the stream messages are moved to, once they've
+	// been delivered MaxDeliveries times without being acknowledged.
+	DeadLetterSuffix = ":dead"
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Publisher  = (*StreamBus)(nil)
+	_ Subscriber = (*StreamBus)(nil)
+	_ Publisher  = (*Broadcast)(nil)
+	_ Subscriber = (*Broadcast)(nil)
+)
+
+// payloadField is the stream entry field a message's payload is stored under.
+const payloadField = "payload"
+
+// Message is a message received from a topic.
+type Message struct {
+	// ID is the stream entry ID of the message. Broadcast messages have no ID.
+	ID string
+
+	Topic   string
+	Payload string
+
+	// Deliveries is how many times the message has been delivered, including this one.
+	Deliveries int
+}
+
+// Handler processes a message. Returning nil acknowledges the message; returning an error leaves
+// it to be delivered again once its visibility timeout passes.
+type Handler func(context.Context, Message) error
+
+// Publisher sends messages to a topic.
+type Publisher interface {
+	Publish(ctx context.Context, topic, payload string) error
+}
+
+// Subscriber receives messages from a topic, passing each to h, until ctx is canceled.
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic string, h Handler) error
+}
+
+// StreamOptions configures a StreamBus or MemoryBus. Zero values take the defaults noted.
+type StreamOptions struct {
+	// Group is the consumer group subscribers read as. Each message is delivered to one subscriber
+	// of each group. Defaults to "default".
+	Group string
+
+	// Consumer names this subscriber within its group. Defaults to the hostname and pid.
+	Consumer string
+
+	// VisibilityTimeout is how long a delivered message may go unacknowledged before it's delivered
+	// again, possibly to another consumer. Defaults to 30s.
+	VisibilityTimeout time.Duration
+
+	// MaxDeliveries is how many times a message is delivered before it's moved to the topic's dead
+	// letter stream, named by DeadLetterSuffix. Defaults to 5.
+	MaxDeliveries int
+
+	// MaxLen, if set, trims each topic to about this many messages as messages are published.
+	MaxLen int64
+
+	// Block is how long a subscriber waits for new messages before checking for messages to
+	// deliver again. It should be shorter than VisibilityTimeout. Defaults to 5s.
+	Block time.Duration
+
+	// BatchSize is the most messages read at once. Defaults to 10.
+	BatchSize int64
+}
+
+// withDefaults fills in the zero values of o.
+func (o StreamOptions) withDefaults() StreamOptions {
+	if o.Group == "" {
+		o.Group = "default"
+	}
+
+	if o.Consumer == "" {
+		host, _ := os.Hostname()
+		o.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = 30 * time.Second
+	}
+
+	if o.MaxDeliveries <= 0 {
+		o.MaxDeliveries = 5
+	}
+
+	if o.Block <= 0 {
+		o.Block = 5 * time.Second
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = 10
+	}
+
+	return o
+}
+
+// StreamBus is a Publisher and Subscriber built on Redis Streams. Each topic is a stream, read by
+// subscribers through a consumer group, so that each message is handled by one subscriber of each
+// group. Groups read a topic from its first message.
+//
+// Messages are delivered at least once. A message left unacknowledged for the visibility timeout
+// is claimed by the next subscriber to check for one, and after MaxDeliveries attempts it's moved
+// to the dead letter stream of the topic.
+type StreamBus struct {
+	c    *Client
+	opts StreamOptions
+}
+
+// NewStreamBus creates a StreamBus on c.
+func NewStreamBus(c *Client, opts StreamOptions) *StreamBus {
+	return &StreamBus{c: c, opts: opts.withDefaults()}
+}
+
+// Publish appends a message to the stream of `topic`.
+func (b *StreamBus) Publish(ctx context.Context, topic, payload string) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout)
+	defer cancel()
+
+	stream := b.c.key(topic)
+
+	r.SetDBMeta("Redis", stream, "XADD")
+	defer r.DatabaseSegment("redis", "stream publish")()
+	return b.c.RDB.XAdd(ctx, b.addArgs(stream, payload)).Err()
+}
+
+// Subscribe reads messages from the stream of `topic` as a member of the consumer group, passing
+// each to h, until ctx is canceled. Returns nil once ctx is canceled, or the first error from Redis.
+// If the Client has a circuit breaker, errors it counts, and commands it rejects, are waited out for
+// its cooldown instead.
+func (b *StreamBus) Subscribe(ctx context.Context, topic string, h Handler) error {
+	stream := b.c.key(topic)
+
+	err := b.createGroup(ctx, stream)
+	for err != nil && b.cooldown(ctx, err) {
+		err = b.createGroup(ctx, stream)
+	}
+
+	for err == nil && ctx.Err() == nil {
+		if err = b.poll(ctx, stream, topic, h); err != nil && b.cooldown(ctx, err) {
+			err = nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// cooldown waits out the cooldown of the circuit breaker of the Client if err opened it, or was
+// returned while it's open. Returns false without waiting for other errors, or once ctx is canceled.
+func (b *StreamBus) cooldown(ctx context.Context, err error) bool {
+	if b.c.breaker == nil || err != ErrCircuitOpen && !isBreakerFailure(err) {
+		return false
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(b.c.breaker.opts.Cooldown):
+		return true
+	}
+}
+
+// poll delivers any messages claimed from other consumers, then waits for and delivers new messages.
+func (b *StreamBus) poll(ctx context.Context, stream, topic string, h Handler) error {
+	claimed, err := b.reclaim(ctx, stream)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range claimed {
+		if err := b.deliver(ctx, stream, topic, msg.XMessage, msg.deliveries, h); err != nil {
+			return err
+		}
+	}
+
+	msgs, err := b.read(ctx, stream)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if err := b.deliver(ctx, stream, topic, msg, 1, h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// claimedMessage is a message claimed from another consumer, and how many times it's been delivered.
+type claimedMessage struct {
+	redis.XMessage
+	deliveries int
+}
+
+// createGroup creates the consumer group on stream, and the stream, if they don't already exist.
+func (b *StreamBus) createGroup(ctx context.Context, stream string) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", stream, "XGROUP CREATE")
+	defer r.DatabaseSegment("redis", "stream create group", b.opts.Group)()
+	err := b.c.RDB.XGroupCreateMkStream(ctx, stream, b.opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+// reclaim claims messages that have gone unacknowledged for the visibility timeout.
+//
+// This is XPENDING followed by XCLAIM rather than XAUTOCLAIM, as go-redis v8 can't read the
+// XAUTOCLAIM reply of Redis 7, and XPENDING also reports how many times each message was delivered.
+func (b *StreamBus) reclaim(ctx context.Context, stream string) ([]claimedMessage, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", stream, "XPENDING XCLAIM")
+	defer r.DatabaseSegment("redis", "stream reclaim", b.opts.Group)()
+	pending, err := b.c.RDB.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  b.opts.Group,
+		Idle:   b.opts.VisibilityTimeout,
+		Start:  "-",
+		End:    "+",
+		Count:  b.opts.BatchSize,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	deliveries := make(map[string]int, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+		deliveries[p.ID] = int(p.RetryCount) + 1
+	}
+
+	// Messages claimed by another consumer since XPENDING are no longer idle, and are skipped.
+	msgs, err := b.c.RDB.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    b.opts.Group,
+		Consumer: b.opts.Consumer,
+		MinIdle:  b.opts.VisibilityTimeout,
+		Messages: ids,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	claimed := make([]claimedMessage, len(msgs))
+	for i, msg := range msgs {
+		claimed[i] = claimedMessage{XMessage: msg, deliveries: deliveries[msg.ID]}
+	}
+
+	return claimed, nil
+}
+
+// read waits up to Block for new messages.
+func (b *StreamBus) read(ctx context.Context, stream string) ([]redis.XMessage, error) {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout+b.opts.Block)
+	defer cancel()
+
+	r.SetDBMeta("Redis", stream, "XREADGROUP")
+	defer r.DatabaseSegment("redis", "stream read", b.opts.Group)()
+	streams, err := b.c.RDB.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    b.opts.Group,
+		Consumer: b.opts.Consumer,
+		Streams:  []string{stream, ">"},
+		Count:    b.opts.BatchSize,
+		Block:    b.opts.Block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+
+	return streams[0].Messages, nil
+}
+
+// deliver passes msg to h, acknowledging it if h succeeds, or moves it to the dead letter stream
+// if it's been delivered too many times.
+func (b *StreamBus) deliver(ctx context.Context, stream, topic string, msg redis.XMessage, deliveries int, h Handler) error {
+	payload, _ := msg.Values[payloadField].(string)
+
+	if deliveries > b.opts.MaxDeliveries {
+		return b.deadLetter(ctx, stream, msg.ID, payload)
+	}
+
+	if err := h(ctx, Message{ID: msg.ID, Topic: topic, Payload: payload, Deliveries: deliveries}); err != nil {
+		return nil
+	}
+
+	return b.ack(ctx, stream, msg.ID)
+}
+
+// ack acknowledges the message at id, removing it from the pending entries of the group.
+func (b *StreamBus) ack(ctx context.Context, stream, id string) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", stream, "XACK")
+	defer r.DatabaseSegment("redis", "stream ack", b.opts.Group)()
+	return b.c.RDB.XAck(ctx, stream, b.opts.Group, id).Err()
+}
+
+// deadLetter moves the message at id to the dead letter stream, and acknowledges it.
+func (b *StreamBus) deadLetter(ctx context.Context, stream, id, payload string) error {
+	r := metrics.GetRecorder(ctx)
+	ctx, cancel := context.WithTimeout(ctx, b.c.requestTimeout)
+	defer cancel()
+
+	r.SetDBMeta("Redis", stream, "XADD XACK")
+	defer r.DatabaseSegment("redis", "stream dead letter", b.opts.Group)()
+
+	// The dead letter stream may be in another hash slot, so this isn't a transaction. Should the
+	// ack fail, the message will be dead lettered again by the next subscriber to claim it.
+	if err := b.c.RDB.XAdd(ctx, b.addArgs(stream+DeadLetterSuffix, payload)).Err(); err != nil {
+		return err
+	}
+
+	return b.c.RDB.XAck(ctx, stream, b.opts.Group, id).Err()
+}
+
+// addArgs returns the XADD arguments appending payload to stream.
+func (b *StreamBus) addArgs(stream, payload string) *redis.XAddArgs {
+	return &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: b.opts.MaxLen,
+		Approx: b.opts.MaxLen > 0,
+		Values: map[string]interface{}{payloadField: payload},
+	}
+}
+
+// Broadcast is a Publisher and Subscriber delivering each message to every current subscriber of a
+// topic, over PubSub. Messages aren't stored, so subscribers miss messages published while they
+// aren't listening, and handler errors are ignored.
+type Broadcast struct {
+	ps PubSub
+}
+
+// NewBroadcast creates a Broadcast on ps.
+func NewBroadcast(ps PubSub) *Broadcast {
+	return &Broadcast{ps: ps}
+}
+
+// Publish sends a message to every current subscriber of `topic`.
+func (b *Broadcast) Publish(ctx context.Context, topic, payload string) error {
+	return b.ps.Publish(metrics.GetRecorder(ctx), topic, payload)
+}
+
+// Subscribe passes each message published to `topic` to h, until ctx is canceled.
+func (b *Broadcast) Subscribe(ctx context.Context, topic string, h Handler) error {
+	msgs, err := b.ps.Subscribe(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	for payload := range msgs {
+		h(ctx, Message{Topic: topic, Payload: payload, Deliveries: 1})
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreams(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := New(mr.Addr(), time.Second, "streams_test")
+	ctx := context.Background()
+
+	buses := map[string]func(StreamOptions) (Publisher, func(StreamOptions) Subscriber){
+		"Stream": func(opts StreamOptions) (Publisher, func(StreamOptions) Subscriber) {
+			return NewStreamBus(rdb, opts), func(opts StreamOptions) Subscriber {
+				return NewStreamBus(rdb, opts)
+			}
+		},
+		"Memory": func(opts StreamOptions) (Publisher, func(StreamOptions) Subscriber) {
+			bus := NewMemoryBus(opts)
+			return bus, func(opts StreamOptions) Subscriber { return bus.WithOptions(opts) }
+		},
+	}
+
+	// subscribe passes each message on topic to h, and sends it to the returned channel.
+	subscribe := func(t *testing.T, s Subscriber, topic string, h Handler) <-chan Message {
+		sctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+
+		msgs := make(chan Message, 100)
+		go func() {
+			defer close(done)
+			require.Nil(t, s.Subscribe(sctx, topic, func(ctx context.Context, msg Message) error {
+				msgs <- msg
+				return h(ctx, msg)
+			}))
+		}()
+
+		return msgs
+	}
+
+	receive := func(t *testing.T, msgs <-chan Message) Message {
+		select {
+		case msg := <-msgs:
+			return msg
+		case <-time.After(2 * time.Second):
+			require.FailNow(t, "no message received")
+			return Message{}
+		}
+	}
+
+	ok := func(context.Context, Message) error { return nil }
+	fail := func(context.Context, Message) error { return errors.New("failed") }
+
+	for name, newBus := range buses {
+		t.Run(name, func(t *testing.T) {
+			opts := StreamOptions{VisibilityTimeout: 100 * time.Millisecond, MaxDeliveries: 2, Block: 20 * time.Millisecond}
+
+			t.Run("Each Group Receives Each Message", func(t *testing.T) {
+				pub, sub := newBus(opts)
+				topic := name + ":groups"
+
+				// Messages published before a group subscribes are delivered too.
+				require.Nil(t, pub.Publish(ctx, topic, "first"))
+
+				a := subscribe(t, sub(StreamOptions{Group: "a", Block: opts.Block}), topic, ok)
+				b := subscribe(t, sub(StreamOptions{Group: "b", Block: opts.Block}), topic, ok)
+				require.Nil(t, pub.Publish(ctx, topic, "second"))
+
+				for _, msgs := range []<-chan Message{a, b} {
+					msg := receive(t, msgs)
+					require.Equal(t, "first", msg.Payload)
+					require.Equal(t, topic, msg.Topic)
+					require.Equal(t, 1, msg.Deliveries)
+					require.NotEmpty(t, msg.ID)
+					require.Equal(t, "second", receive(t, msgs).Payload)
+				}
+			})
+
+			t.Run("Consumers Share A Group", func(t *testing.T) {
+				pub, sub := newBus(opts)
+				topic := name + ":shared"
+
+				shared := StreamOptions{Group: "workers", Block: opts.Block, BatchSize: 1}
+				shared.Consumer = "one"
+				one := subscribe(t, sub(shared), topic, ok)
+				shared.Consumer = "two"
+				two := subscribe(t, sub(shared), topic, ok)
+
+				for i := 0; i < 10; i++ {
+					require.Nil(t, pub.Publish(ctx, topic, "job"))
+				}
+
+				seen := map[string]bool{}
+				for i := 0; i < 10; i++ {
+					var msg Message
+					select {
+					case msg = <-one:
+					case msg = <-two:
+					case <-time.After(2 * time.Second):
+						require.FailNow(t, "no message received")
+					}
+
+					require.False(t, seen[msg.ID], "message delivered twice")
+					seen[msg.ID] = true
+				}
+			})
+
+			t.Run("Redelivers Then Dead Letters", func(t *testing.T) {
+				pub, sub := newBus(opts)
+				topic := name + ":failing"
+
+				msgs := subscribe(t, sub(opts), topic, fail)
+				dead := subscribe(t, sub(StreamOptions{Group: "dead", Block: opts.Block}), topic+DeadLetterSuffix, ok)
+				require.Nil(t, pub.Publish(ctx, topic, "poison"))
+
+				first := receive(t, msgs)
+				require.Equal(t, 1, first.Deliveries)
+
+				start := time.Now()
+				second := receive(t, msgs)
+				require.Equal(t, first.ID, second.ID)
+				require.Equal(t, 2, second.Deliveries)
+				require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+				require.Equal(t, "poison", receive(t, dead).Payload)
+
+				select {
+				case msg := <-msgs:
+					require.FailNow(t, "dead lettered message redelivered", msg)
+				case <-time.After(300 * time.Millisecond):
+				}
+			})
+
+			t.Run("Acknowledged Messages Aren't Redelivered", func(t *testing.T) {
+				pub, sub := newBus(opts)
+				topic := name + ":acked"
+
+				msgs := subscribe(t, sub(opts), topic, ok)
+				require.Nil(t, pub.Publish(ctx, topic, "done"))
+				require.Equal(t, "done", receive(t, msgs).Payload)
+
+				select {
+				case msg := <-msgs:
+					require.FailNow(t, "acknowledged message redelivered", msg)
+				case <-time.After(300 * time.Millisecond):
+				}
+			})
+		})
+	}
+
+	t.Run("Stream Trims To MaxLen", func(t *testing.T) {
+		pub := NewStreamBus(rdb, StreamOptions{MaxLen: 2})
+		for i := 0; i < 5; i++ {
+			require.Nil(t, pub.Publish(ctx, "trimmed", "message"))
+		}
+
+		n, err := rdb.RDB.XLen(ctx, "trimmed").Result()
+		require.Nil(t, err)
+		require.Equal(t, int64(2), n)
+	})
+
+	t.Run("Broadcast", func(t *testing.T) {
+		bus := NewBroadcast(rdb)
+		a := subscribe(t, bus, "broadcast", fail)
+		b := subscribe(t, bus, "broadcast", ok)
+
+		// Subscribe returns once subscribed, which the goroutines may not have reached yet.
+		require.Eventually(t, func() bool {
+			n, _ := rdb.RDB.PubSubNumSub(ctx, "broadcast").Result()
+			return n["broadcast"] == 2
+		}, time.Second, 10*time.Millisecond)
+
+		require.Nil(t, bus.Publish(ctx, "broadcast", "hello"))
+		for _, msgs := range []<-chan Message{a, b} {
+			msg := receive(t, msgs)
+			require.Equal(t, "hello", msg.Payload)
+			require.Empty(t, msg.ID)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// TagPrefix is prepended, after the Namespace, to the name of the set holding the keys for a tag.
+	TagPrefix = "tag:"
+
+	// scanBatchSize is the number of keys requested from each SCAN, and removed by each DEL.
+	scanBatchSize int64 = 500
+
+	// Compiler will enforce the interface and let us know if the contract is broken.
+	_ Tagger = (*Client)(nil)
+
+	// setWithTags stores a value and adds its key to each tag set. A tag set lives as long as the
+	// longest lived key it holds.
+	//
+	// KEYS[1] is the key, KEYS[2:] the tag sets. ARGV[1] is the value, ARGV[2] the TTL in ms, or 0 for none.
+	setWithTags = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+
+for i = 2, #KEYS do
+	local existed = redis.call('EXISTS', KEYS[i])
+	redis.call('SADD', KEYS[i], KEYS[1])
+
+	if ttl <= 0 then
+		redis.call('PERSIST', KEYS[i])
+	elseif existed == 0 then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+	else
+		local current = redis.call('PTTL', KEYS[i])
+		if current >= 0 and current < ttl then
+			redis.call('PEXPIRE', KEYS[i], ttl)
+		end
+	end
+end
+
+return 1
+`)
+
+	// invalidateTag removes every key in a tag set, and the set itself.
+	//
+	// KEYS[1] is the tag set. ARGV[1] is the number of keys to remove per DEL.
+	invalidateTag = redis.NewScript(`
+local keys = redis.call('SMEMBERS', KEYS[1])
+local batch = tonumber(ARGV[1])
+
+for i = 1, #keys, batch do
+	redis.call('DEL', unpack(keys, i, math.min(i + batch - 1, #keys)))
+end
+
+redis.call('DEL', KEYS[1])
+return #keys
+`)
+)
+
+// SetWithTags stores the value at `key` with the provided TTL, and associates `key` with each tag
+// so that it's removed by InvalidateTag.
+func (c *Client) SetWithTags(r metrics.Recorder, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return c.SetWithDuration(r, key, value, ttl)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, c.key(key))
+	for _, tag := range tags {
+		keys = append(keys, c.key(TagPrefix+tag))
+	}
+
+	r.SetDBMeta("Redis", keys[0], "EVALSHA SET SADD")
+	defer r.DatabaseSegment("redis", "set with tags", value, ttl, tags)()
+	err := setWithTags.Run(ctx, c.RDB, keys, value, ttl.Milliseconds()).Err()
+	if err != nil && err != redis.Nil {
+		return writeErr(err)
+	}
+
+	return nil
+}
+
+// InvalidateTag removes every key associated with `tag`.
+func (c *Client) InvalidateTag(r metrics.Recorder, tag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	set := c.key(TagPrefix + tag)
+
+	r.SetDBMeta("Redis", set, "EVALSHA SMEMBERS DEL")
+	defer r.DatabaseSegment("redis", "invalidate tag")()
+	err := invalidateTag.Run(ctx, c.RDB, []string{set}, scanBatchSize).Err()
+	if err != nil && err != redis.Nil {
+		return writeErr(err)
+	}
+
+	return nil
+}
+
+// DeletePrefix removes every key beginning with `prefix`. Keys are found with SCAN, so keys written
+// while the delete is in progress may survive it.
+func (c *Client) DeletePrefix(r metrics.Recorder, prefix string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+	defer cancel()
+
+	match := escapePattern(c.key(prefix)) + "*"
+
+	r.SetDBMeta("Redis", match, "SCAN DEL")
+	defer r.DatabaseSegment("redis", "delete prefix")()
+
+	// Each node of a cluster holds its own keys, and must be scanned separately.
+	if cc, ok := c.RDB.(*redis.ClusterClient); ok {
+		return writeErr(cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.deleteMatching(ctx, node, match)
+		}))
+	}
+
+	return writeErr(c.deleteMatching(ctx, c.RDB, match))
+}
+
+// deleteMatching removes every key in rdb matching the SCAN pattern match.
+func (c *Client) deleteMatching(ctx context.Context, rdb redis.Cmdable, match string) error {
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, match, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := c.del(ctx, rdb, keys); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// escapePattern escapes the glob characters understood by SCAN MATCH.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
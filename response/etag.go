@@ -0,0 +1,56 @@
+package response
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag for a response body.
+func ETag(body []byte) string {
+	sum := md5.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// MatchETag reports whether an If-None-Match header value matches etag. Comparison is weak, as
+// required for If-None-Match, and tolerates tags sent without quotes.
+func MatchETag(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || opaqueTag(candidate) == opaqueTag(etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NotModified reports whether the conditional headers of r show that the client already holds the
+// response identified by etag and lastModified. If-None-Match takes precedence over If-Modified-Since.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return MatchETag(inm, etag)
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// opaqueTag strips the weakness indicator and quotes from an entity tag.
+func opaqueTag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
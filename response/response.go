@@ -3,8 +3,6 @@ package response
 
 import (
 	"bytes"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -38,18 +36,13 @@ func serveJSON(w http.ResponseWriter, r *http.Request, statusCode int, data inte
 
 	b := buf.Bytes()
 
-	if etag {
-		sum := md5.Sum(b)
-		etag := hex.EncodeToString(sum[:])
+	if etag && statusCode/100 == 2 {
+		etag := ETag(b)
+		w.Header().Set("ETag", etag)
 
-		if statusCode/100 == 2 {
-			match := r.Header.Get("If-None-Match")
-			if etag == match {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-
-			w.Header().Set("ETag", etag)
+		if MatchETag(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
 	}
 